@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// tokenRefreshMargin is how long before it expires a cached EKS token is
+// replaced. Tokens are valid for 15 minutes.
+const tokenRefreshMargin = time.Minute
+
+// cache keeps AWS SDK configurations across warm invocations
+var cache = struct {
+	sync.Mutex
+	awsConfigs     map[string]aws.Config
+	tokenGenerator token.Generator
+}{
+	awsConfigs: map[string]aws.Config{},
+}
+
+// loadAWSConfig returns the AWS SDK configuration for region
+func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if awsCfg, ok := cache.awsConfigs[region]; ok {
+		return awsCfg, nil
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	cache.awsConfigs[region] = awsCfg
+	return awsCfg, nil
+}
+
+// eksClusters connects to EKS clusters through the EKS API, and keeps the
+// connections across warm invocations
+type eksClusters struct {
+	api EKSAPI
+
+	mu          sync.Mutex
+	connections map[string]*eksCluster
+}
+
+// newEKSClusters returns Clusters connecting through api
+func newEKSClusters(api EKSAPI) *eksClusters {
+	return &eksClusters{api: api, connections: map[string]*eksCluster{}}
+}
+
+// Kubernetes returns the clientset of EKS cluster clusterName
+func (c *eksClusters) Kubernetes(ctx context.Context, clusterName string) (kubernetes.Interface, error) {
+	cluster, err := c.get(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.clientset, nil
+}
+
+// Dynamic returns the dynamic client of EKS cluster clusterName
+func (c *eksClusters) Dynamic(ctx context.Context, clusterName string) (dynamic.Interface, error) {
+	cluster, err := c.get(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.dynamic, nil
+}
+
+// eksCluster is the cached connection to an EKS cluster. Its clients
+// authenticate every request with a cached token, refreshed before it expires.
+type eksCluster struct {
+	name      string
+	owner     *eksClusters
+	config    *rest.Config
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+
+	// generate returns a new token for the cluster
+	generate func() (token.Token, error)
+
+	mu    sync.Mutex
+	token token.Token
+}
+
+// get returns the connection to EKS cluster clusterName, describing the
+// cluster on first use
+func (c *eksClusters) get(ctx context.Context, clusterName string) (*eksCluster, error) {
+	c.mu.Lock()
+	cluster, ok := c.connections[clusterName]
+	c.mu.Unlock()
+	if ok {
+		return cluster, nil
+	}
+
+	cluster, err := c.connect(ctx, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another invocation may have connected in the meantime
+	if existing, ok := c.connections[clusterName]; ok {
+		return existing, nil
+	}
+	c.connections[clusterName] = cluster
+	return cluster, nil
+}
+
+// connect describes EKS cluster clusterName and creates its clients
+func (c *eksClusters) connect(ctx context.Context, clusterName string) (*eksCluster, error) {
+	logFrom(ctx).Info("Connecting to EKS cluster")
+
+	// Get EKS cluster information
+	clusterOutput, err := c.api.DescribeCluster(ctx, &eks.DescribeClusterInput{
+		Name: &clusterName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe EKS cluster: %w", err)
+	}
+
+	// The cluster CA is returned base64 encoded
+	caData, err := base64.StdEncoding.DecodeString(aws.ToString(clusterOutput.Cluster.CertificateAuthority.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cluster certificate authority: %w", err)
+	}
+
+	cluster := &eksCluster{
+		name:  clusterName,
+		owner: c,
+		generate: func() (token.Token, error) {
+			gen, err := getTokenGenerator()
+			if err != nil {
+				return token.Token{}, err
+			}
+			return gen.Get(clusterName)
+		},
+	}
+	cluster.config = &rest.Config{
+		Host: aws.ToString(clusterOutput.Cluster.Endpoint),
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: caData,
+		},
+		WrapTransport: cluster.wrapTransport,
+	}
+	if cluster.clientset, err = kubernetes.NewForConfig(cluster.config); err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	if cluster.dynamic, err = dynamic.NewForConfig(cluster.config); err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	return cluster, nil
+}
+
+// getTokenGenerator returns the aws-iam-authenticator token generator
+func getTokenGenerator() (token.Generator, error) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.tokenGenerator == nil {
+		gen, err := token.NewGenerator(true, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create token generator: %w", err)
+		}
+		cache.tokenGenerator = gen
+	}
+	return cache.tokenGenerator, nil
+}
+
+// bearerToken returns the cached token, generating a new one when it is
+// missing or about to expire
+func (c *eksCluster) bearerToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.Token == "" || time.Until(c.token.Expiration) < tokenRefreshMargin {
+		tok, err := c.generate()
+		if err != nil {
+			return "", fmt.Errorf("failed to get authentication token: %w", err)
+		}
+		c.token = tok
+	}
+	return c.token.Token, nil
+}
+
+// invalidate drops the cached token, and the connection from its owner so
+// the next invocation describes the cluster again
+func (c *eksCluster) invalidate() {
+	c.mu.Lock()
+	c.token = token.Token{}
+	c.mu.Unlock()
+
+	if c.owner == nil {
+		return
+	}
+	c.owner.mu.Lock()
+	defer c.owner.mu.Unlock()
+	if c.owner.connections[c.name] == c {
+		delete(c.owner.connections, c.name)
+	}
+}
+
+func (c *eksCluster) wrapTransport(next http.RoundTripper) http.RoundTripper {
+	return &authRoundTripper{cluster: c, next: next}
+}
+
+// authRoundTripper authenticates requests with the token of a cluster. A
+// request rejected as unauthorized invalidates the cluster, and is sent once
+// more with a new token when its body can be replayed.
+type authRoundTripper struct {
+	cluster *eksCluster
+	next    http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.send(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	rt.cluster.invalidate()
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_ = resp.Body.Close()
+	return rt.send(retry)
+}
+
+func (rt *authRoundTripper) send(req *http.Request) (*http.Response, error) {
+	tok, err := rt.cluster.bearerToken()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return rt.next.RoundTrip(req)
+}
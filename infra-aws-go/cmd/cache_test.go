@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
+)
+
+// fakeEKS is an EKSAPI describing every cluster as output
+type fakeEKS struct {
+	output    *eks.DescribeClusterOutput
+	described []string
+}
+
+func (f *fakeEKS) DescribeCluster(_ context.Context, params *eks.DescribeClusterInput, _ ...func(*eks.Options)) (*eks.DescribeClusterOutput, error) {
+	f.described = append(f.described, aws.ToString(params.Name))
+	return f.output, nil
+}
+
+var _ = Describe("EKS connection cache", func() {
+	var (
+		clusters  *eksClusters
+		cluster   *eksCluster
+		generated int
+		validFor  time.Duration
+	)
+
+	BeforeEach(func() {
+		generated, validFor = 0, 14*time.Minute
+		clusters = newEKSClusters(nil)
+		cluster = &eksCluster{
+			name:  "prod",
+			owner: clusters,
+			generate: func() (token.Token, error) {
+				generated++
+				return token.Token{Token: fmt.Sprintf("token-%d", generated), Expiration: time.Now().Add(validFor)}, nil
+			},
+		}
+	})
+
+	It("Should describe clusters once and keep their connections", func() {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		DeferCleanup(server.Close)
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		api := &fakeEKS{output: &eks.DescribeClusterOutput{Cluster: &ekstypes.Cluster{
+			Endpoint:             aws.String(server.URL),
+			CertificateAuthority: &ekstypes.Certificate{Data: aws.String(base64.StdEncoding.EncodeToString(ca))},
+		}}}
+		clusters = newEKSClusters(api)
+
+		first, err := clusters.get(context.Background(), "prod")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.config.Host).To(Equal(server.URL))
+		Expect(first.config.CAData).To(Equal(ca))
+		Expect(clusters.Kubernetes(context.Background(), "prod")).To(BeIdenticalTo(first.clientset))
+		Expect(api.described).To(Equal([]string{"prod"}))
+	})
+
+	It("Should reuse tokens until they are about to expire", func() {
+		Expect(cluster.bearerToken()).To(Equal("token-1"))
+		Expect(cluster.bearerToken()).To(Equal("token-1"))
+
+		cluster.token.Expiration = time.Now().Add(tokenRefreshMargin / 2)
+		Expect(cluster.bearerToken()).To(Equal("token-2"))
+	})
+
+	It("Should retry unauthorized requests once with a new token and drop the cluster", func() {
+		clusters.connections[cluster.name] = cluster
+
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		DeferCleanup(server.Close)
+
+		client := &http.Client{Transport: cluster.wrapTransport(http.DefaultTransport)}
+		resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{"data":{}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(bodies).To(Equal([]string{`{"data":{}}`, `{"data":{}}`}))
+
+		Expect(clusters.connections).NotTo(HaveKey(cluster.name))
+	})
+
+	It("Should give up when the new token is rejected too", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		DeferCleanup(server.Close)
+
+		client := &http.Client{Transport: cluster.wrapTransport(http.DefaultTransport)}
+		resp, err := client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(generated).To(Equal(2))
+	})
+})
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// resolveClusters returns the EKS clusters an AWS secret is synced to: the
+// ones listed in its ClustersTag, or every configured cluster.
+func resolveClusters(cfg Config, tags map[string]string) []string {
+	if tagged, ok := tags[ClustersTag]; ok {
+		return dedupe(strings.Fields(tagged))
+	}
+	return cfg.EKSClusterNames
+}
+
+// forEachCluster calls fn for every cluster with the concurrency of h.
+// Clusters a tag names that are not in EKS_CLUSTER_NAMES fail without being
+// connected to: the Lambda is only granted access to those.
+func (h *Handler) forEachCluster(ctx context.Context, clusters []string, fn func(ctx context.Context, cluster string) ([]TargetResult, error)) []ClusterResult {
+	return forEachCluster(ctx, clusters, h.cfg.MaxConcurrency, func(ctx context.Context, cluster string) ([]TargetResult, error) {
+		if !slices.Contains(h.cfg.EKSClusterNames, cluster) {
+			return nil, fmt.Errorf("cluster %s is not one of EKS_CLUSTER_NAMES", cluster)
+		}
+		return fn(ctx, cluster)
+	})
+}
+
+// forEachCluster calls fn for every cluster, running at most limit calls at a
+// time. fn returns the outcome of every target in the cluster, or an error
+// when it could not reach them. A failing cluster does not stop the others;
+// results are in the order of clusters.
+func forEachCluster(ctx context.Context, clusters []string, limit int, fn func(ctx context.Context, cluster string) ([]TargetResult, error)) []ClusterResult {
+	if limit < 1 {
+		limit = 1
+	}
+
+	results := make([]ClusterResult, len(clusters))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ctx := withLogger(ctx, logFrom(ctx).With("cluster", cluster))
+			targets, err := fn(ctx, cluster)
+			results[i] = ClusterResult{Cluster: cluster, Targets: targets}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// logResults logs the outcome for every cluster and target
+func logResults(ctx context.Context, results []ClusterResult) {
+	log := logFrom(ctx)
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+		if result.Error != "" {
+			log.Error("Cluster failed", "cluster", result.Cluster, "error", result.Error)
+			continue
+		}
+		for _, target := range result.Targets {
+			attrs := []any{"cluster", result.Cluster, "namespace", target.Namespace, "name", target.Name, "outcome", target.Outcome}
+			if target.Error != "" {
+				log.Error("Target failed", append(attrs, "error", target.Error)...)
+				continue
+			}
+			log.Info("Target done", attrs...)
+		}
+	}
+	log.Info("Event processed", "clusters", len(results), "failedClusters", failed)
+}
+
+// dedupe returns values without repeats, keeping the first occurrence
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multi-cluster sync", func() {
+	cfg := Config{EKSClusterNames: []string{"dev", "staging", "prod"}}
+
+	It("Should sync to every configured cluster by default", func() {
+		Expect(resolveClusters(cfg, nil)).To(Equal([]string{"dev", "staging", "prod"}))
+	})
+
+	It("Should sync to the clusters the secret is tagged for", func() {
+		Expect(resolveClusters(cfg, map[string]string{ClustersTag: "prod  prod-eu prod"})).To(Equal([]string{"prod", "prod-eu"}))
+		Expect(resolveClusters(cfg, map[string]string{ClustersTag: ""})).To(BeEmpty())
+	})
+
+	It("Should bound the number of clusters synced at once", func() {
+		var running, peak atomic.Int32
+		clusters := []string{"a", "b", "c", "d", "e", "f"}
+		results := forEachCluster(context.Background(), clusters, 2, func(context.Context, string) ([]TargetResult, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil, nil
+		})
+		Expect(results).To(HaveLen(len(clusters)))
+		Expect(peak.Load()).To(BeNumerically("<=", 2))
+	})
+
+	It("Should keep syncing past a failing cluster", func() {
+		results := forEachCluster(context.Background(), []string{"dev", "staging", "prod"}, 1, func(_ context.Context, cluster string) ([]TargetResult, error) {
+			if cluster == "staging" {
+				return nil, errors.New("unreachable")
+			}
+			return []TargetResult{{Namespace: "default", Name: "app", Outcome: OutcomeUpdated}}, nil
+		})
+		updated := []TargetResult{{Namespace: "default", Name: "app", Outcome: OutcomeUpdated}}
+		Expect(results).To(Equal([]ClusterResult{
+			{Cluster: "dev", Targets: updated},
+			{Cluster: "staging", Error: "unreachable"},
+			{Cluster: "prod", Targets: updated},
+		}))
+		Expect(results[0].Failed()).To(BeFalse())
+		Expect(results[1].Failed()).To(BeTrue())
+	})
+
+	It("Should report every outcome in the error of a failed event", func() {
+		result := Result{
+			EventID:   "event",
+			EventName: EventPutSecretValue,
+			SecretID:  "eks-sync-app",
+			VersionID: "v1",
+			Clusters: []ClusterResult{
+				{Cluster: "dev", Targets: []TargetResult{{Namespace: "default", Name: "app", Outcome: OutcomeCreated}}},
+				{Cluster: "prod", Targets: []TargetResult{newTargetResult("default", "app", OutcomeRefused, ErrNotOwned)}},
+			},
+		}
+		Expect(result.Failed()).To(BeTrue())
+		Expect((&ResultError{Result: result}).Error()).To(MatchJSON(`{
+			"eventId": "event",
+			"eventName": "PutSecretValue",
+			"secretId": "eks-sync-app",
+			"versionId": "v1",
+			"clusters": [
+				{"cluster": "dev", "targets": [{"namespace": "default", "name": "app", "outcome": "created"}]},
+				{"cluster": "prod", "targets": [{"namespace": "default", "name": "app", "outcome": "refused", "error": "secret is not managed by the Lambda"}]}
+			]
+		}`))
+	})
+})
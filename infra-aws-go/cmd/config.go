@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration of the Lambda, from environment variables
+type Config struct {
+	EKSClusterNames  []string        // Clusters secrets are synced to unless tagged otherwise
+	MaxConcurrency   int             // Clusters synced at the same time
+	Region           string          // Region of the secrets and the clusters
+	SecretPrefix     string          // Prefix of synced secrets without ROUTING_FILE (e.g., "eks-sync-")
+	Namespace        string          // Default kubernetes namespace
+	Routing          Routing         // Rules from ROUTING_FILE, or a rule matching SecretPrefix
+	FlattenSeparator string          // Joins the keys of nested JSON objects; must match the operator
+	SyncMode         SyncMode        // Whether the Lambda writes Secrets or nudges the operator
+	DeletePolicy     DeletePolicy    // What happens to Secrets whose AWS secret is deleted
+	OwnershipPolicy  OwnershipPolicy // What happens to existing Secrets managed by someone else
+
+	// AllowedNamespaces are the namespaces NamespaceTag may name besides
+	// those of the matching routing rule
+	AllowedNamespaces []string
+}
+
+// eksClusterName matches valid EKS cluster names
+var eksClusterName = regexp.MustCompile(`^[0-9A-Za-z][A-Za-z0-9_-]{0,99}$`)
+
+// secretKeyChars matches separators allowed in Secret keys
+var secretKeyChars = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// ssmPrefix marks a ROUTING_FILE read from SSM Parameter Store
+const ssmPrefix = "ssm:"
+
+// Step 1: Load configuration from environment variables. getenv is os.Getenv
+// outside tests. Every invalid setting is reported, not just the first.
+func loadConfig(ctx context.Context, getenv func(string) string) (Config, error) {
+	cfg := Config{
+		// A comma or space separated list; EKS_CLUSTER_NAME is the single
+		// cluster form
+		EKSClusterNames: dedupe(strings.FieldsFunc(getenv("EKS_CLUSTER_NAMES"), func(r rune) bool {
+			return r == ',' || r == ' '
+		})),
+		// A comma or space separated list, like EKS_CLUSTER_NAMES
+		AllowedNamespaces: dedupe(strings.FieldsFunc(getenv("ALLOWED_NAMESPACES"), func(r rune) bool {
+			return r == ',' || r == ' '
+		})),
+		MaxConcurrency:   4,
+		Region:           getenv("AWS_REGION"),
+		SecretPrefix:     getenv("SECRET_PREFIX"),
+		Namespace:        getenv("K8S_NAMESPACE"),
+		FlattenSeparator: getenv("FLATTEN_SEPARATOR"),
+		SyncMode:         SyncMode(getenv("SYNC_MODE")),
+		DeletePolicy:     DeletePolicy(getenv("DELETE_POLICY")),
+		OwnershipPolicy:  OwnershipPolicy(getenv("OWNERSHIP_POLICY")),
+	}
+	if name := getenv("EKS_CLUSTER_NAME"); len(cfg.EKSClusterNames) == 0 && name != "" {
+		cfg.EKSClusterNames = []string{name}
+	}
+
+	// Set defaults
+	if cfg.SecretPrefix == "" {
+		cfg.SecretPrefix = "eks-sync-"
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = "default"
+	}
+	if cfg.SyncMode == "" {
+		cfg.SyncMode = SyncModeWrite
+	}
+	if cfg.DeletePolicy == "" {
+		cfg.DeletePolicy = DeletePolicyOrphan
+	}
+	if cfg.OwnershipPolicy == "" {
+		cfg.OwnershipPolicy = OwnershipPolicyRefuse
+	}
+
+	var errs []error
+	if len(cfg.EKSClusterNames) == 0 {
+		errs = append(errs, errors.New("EKS_CLUSTER_NAMES or EKS_CLUSTER_NAME is required"))
+	}
+	for _, name := range cfg.EKSClusterNames {
+		if !eksClusterName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid EKS cluster name %q", name))
+		}
+	}
+	// The Lambda runtime always sets the region; there is no safe default
+	if cfg.Region == "" {
+		errs = append(errs, errors.New("AWS_REGION is required"))
+	}
+	if value := getenv("MAX_CONCURRENCY"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("MAX_CONCURRENCY must be a positive integer, got %q", value))
+		}
+		cfg.MaxConcurrency = n
+	}
+	if problems := validation.IsDNS1123Label(cfg.Namespace); len(problems) > 0 {
+		errs = append(errs, fmt.Errorf("invalid K8S_NAMESPACE %q: %s", cfg.Namespace, strings.Join(problems, ", ")))
+	}
+	for _, namespace := range cfg.AllowedNamespaces {
+		if problems := validation.IsDNS1123Label(namespace); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("invalid namespace %q in ALLOWED_NAMESPACES: %s", namespace, strings.Join(problems, ", ")))
+		}
+	}
+	if cfg.FlattenSeparator != "" && !secretKeyChars.MatchString(cfg.FlattenSeparator) {
+		errs = append(errs, fmt.Errorf("FLATTEN_SEPARATOR may only hold letters, digits, '-', '_' and '.', got %q", cfg.FlattenSeparator))
+	}
+	switch cfg.SyncMode {
+	case SyncModeWrite, SyncModeNudge:
+	default:
+		errs = append(errs, fmt.Errorf("SYNC_MODE must be %s or %s, got %q", SyncModeWrite, SyncModeNudge, cfg.SyncMode))
+	}
+	switch cfg.DeletePolicy {
+	case DeletePolicyDelete, DeletePolicyRetain, DeletePolicyOrphan:
+	default:
+		errs = append(errs, fmt.Errorf("DELETE_POLICY must be one of %s, %s or %s, got %q", DeletePolicyDelete, DeletePolicyRetain, DeletePolicyOrphan, cfg.DeletePolicy))
+	}
+	switch cfg.OwnershipPolicy {
+	case OwnershipPolicyRefuse, OwnershipPolicyMerge:
+	default:
+		errs = append(errs, fmt.Errorf("OWNERSHIP_POLICY must be %s or %s, got %q", OwnershipPolicyRefuse, OwnershipPolicyMerge, cfg.OwnershipPolicy))
+	}
+
+	// The routing file is only read once the rest is known to be valid. It
+	// replaces SECRET_PREFIX.
+	if location := getenv("ROUTING_FILE"); location != "" && len(errs) == 0 {
+		routing, err := loadRouting(ctx, cfg.Region, location, cfg.Namespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ROUTING_FILE %s: %w", location, err))
+		}
+		cfg.Routing = routing
+	} else if location == "" {
+		cfg.Routing = defaultRouting(cfg.SecretPrefix, cfg.Namespace)
+		if err := cfg.Routing.compile(cfg.Namespace); err != nil {
+			errs = append(errs, fmt.Errorf("invalid SECRET_PREFIX %q: %w", cfg.SecretPrefix, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+
+	slog.Info("Configuration loaded",
+		"clusters", cfg.EKSClusterNames, "maxConcurrency", cfg.MaxConcurrency, "region", cfg.Region,
+		"prefix", cfg.SecretPrefix, "namespace", cfg.Namespace, "allowedNamespaces", cfg.AllowedNamespaces,
+		"routingRules", len(cfg.Routing.Rules),
+		"flattenSeparator", cfg.FlattenSeparator, "syncMode", cfg.SyncMode,
+		"deletePolicy", cfg.DeletePolicy, "ownershipPolicy", cfg.OwnershipPolicy)
+	return cfg, nil
+}
+
+// loadRouting reads and compiles the routing file at location: a path to a
+// file bundled with the Lambda, or "ssm:<name>" for a Parameter Store
+// parameter. Either holds JSON or YAML. Rules without namespaces get
+// defaultNamespace.
+func loadRouting(ctx context.Context, region, location, defaultNamespace string) (Routing, error) {
+	var content []byte
+	if name, ok := strings.CutPrefix(location, ssmPrefix); ok {
+		awsCfg, err := loadAWSConfig(ctx, region)
+		if err != nil {
+			return Routing{}, err
+		}
+		output, err := ssm.NewFromConfig(awsCfg).GetParameter(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return Routing{}, fmt.Errorf("failed to get parameter: %w", err)
+		}
+		content = []byte(aws.ToString(output.Parameter.Value))
+	} else {
+		var err error
+		if content, err = os.ReadFile(location); err != nil {
+			return Routing{}, err
+		}
+	}
+
+	var routing Routing
+	if err := yaml.UnmarshalStrict(content, &routing); err != nil {
+		return Routing{}, fmt.Errorf("failed to parse routing: %w", err)
+	}
+	if len(routing.Rules) == 0 {
+		return Routing{}, errors.New("no rules")
+	}
+	return routing, routing.compile(defaultNamespace)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Configuration", func() {
+	var env map[string]string
+
+	BeforeEach(func() {
+		env = map[string]string{
+			"EKS_CLUSTER_NAMES": "dev, staging prod",
+			"AWS_REGION":        "ap-southeast-1",
+		}
+	})
+
+	load := func() (Config, error) {
+		return loadConfig(context.Background(), func(key string) string { return env[key] })
+	}
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), name)
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("Should default every optional setting", func() {
+		cfg, err := load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Routing.Rules).To(HaveLen(1))
+		Expect(resolveTargets(cfg, "eks-sync-app", nil)).To(Equal([]SyncTarget{
+			{Namespace: "default", Name: "eks-sync-app", Type: corev1.SecretTypeOpaque},
+		}))
+		Expect(resolveTargets(cfg, "other-app", nil)).To(BeEmpty())
+
+		cfg.Routing = Routing{}
+		Expect(cfg).To(Equal(Config{
+			EKSClusterNames: []string{"dev", "staging", "prod"},
+			MaxConcurrency:  4,
+			Region:          "ap-southeast-1",
+			SecretPrefix:    "eks-sync-",
+			Namespace:       "default",
+			SyncMode:        SyncModeWrite,
+			DeletePolicy:    DeletePolicyOrphan,
+			OwnershipPolicy: OwnershipPolicyRefuse,
+		}))
+	})
+
+	It("Should accept the single cluster form", func() {
+		delete(env, "EKS_CLUSTER_NAMES")
+		env["EKS_CLUSTER_NAME"] = "prod"
+		cfg, err := load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.EKSClusterNames).To(Equal([]string{"prod"}))
+	})
+
+	It("Should read the namespaces tags may name", func() {
+		env["ALLOWED_NAMESPACES"] = "team-a, team-b team-a"
+		cfg, err := load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.AllowedNamespaces).To(Equal([]string{"team-a", "team-b"}))
+	})
+
+	It("Should report every invalid setting", func() {
+		env = map[string]string{
+			"EKS_CLUSTER_NAMES":  "prod -bad",
+			"MAX_CONCURRENCY":    "0",
+			"K8S_NAMESPACE":      "Team_A",
+			"FLATTEN_SEPARATOR":  "/",
+			"SYNC_MODE":          "push",
+			"DELETE_POLICY":      "purge",
+			"OWNERSHIP_POLICY":   "steal",
+			"ALLOWED_NAMESPACES": "team-a,Team_B",
+			"ROUTING_FILE":       "/does/not/exist",
+		}
+		_, err := load()
+		Expect(err).To(HaveOccurred())
+		for _, problem := range []string{
+			`invalid EKS cluster name "-bad"`,
+			"AWS_REGION is required",
+			`MAX_CONCURRENCY must be a positive integer, got "0"`,
+			`invalid K8S_NAMESPACE "Team_A"`,
+			`FLATTEN_SEPARATOR may only hold`,
+			`SYNC_MODE must be write or nudge, got "push"`,
+			`DELETE_POLICY must be one of delete, retain or orphan, got "purge"`,
+			`OWNERSHIP_POLICY must be refuse or merge, got "steal"`,
+			`invalid namespace "Team_B" in ALLOWED_NAMESPACES`,
+		} {
+			Expect(err.Error()).To(ContainSubstring(problem))
+		}
+		// The routing file is not read while the rest is invalid
+		Expect(err.Error()).NotTo(ContainSubstring("ROUTING_FILE"))
+	})
+
+	It("Should require a cluster", func() {
+		delete(env, "EKS_CLUSTER_NAMES")
+		_, err := load()
+		Expect(err).To(MatchError("EKS_CLUSTER_NAMES or EKS_CLUSTER_NAME is required"))
+	})
+
+	DescribeTable("bundled routing files",
+		func(name, content string) {
+			env["ROUTING_FILE"] = writeFile(name, content)
+			cfg, err := load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resolveTargets(cfg, "eks-sync-team-a/app", nil)).To(Equal([]SyncTarget{
+				{Namespace: "team-a", Name: "app", Type: corev1.SecretTypeOpaque},
+			}))
+			Expect(resolveTargets(cfg, "eks-sync-shared/app", nil)).To(Equal([]SyncTarget{
+				{Namespace: "default", Name: "eks-sync-shared-app", Type: corev1.SecretTypeOpaque},
+			}))
+		},
+		Entry("in YAML", "routing.yaml", `
+rules:
+- match:
+    name:
+      glob: eks-sync-team-a/*
+  namespaces: [team-a]
+  nameTemplate: '{{ .Name | trimPrefix "eks-sync-team-a/" }}'
+- match:
+    name: {glob: eks-sync-*}
+`),
+		Entry("in JSON", "routing.json", `{"rules": [
+			{"match": {"name": {"glob": "eks-sync-team-a/*"}}, "namespaces": ["team-a"], "nameTemplate": "{{ .Name | trimPrefix \"eks-sync-team-a/\" }}"},
+			{"match": {"name": {"glob": "eks-sync-*"}}}
+		]}`),
+	)
+
+	DescribeTable("invalid routing files",
+		func(content, problem string) {
+			env["ROUTING_FILE"] = writeFile("routing.yaml", content)
+			_, err := load()
+			Expect(err).To(MatchError(ContainSubstring(problem)))
+		},
+		Entry("no rules", "rules: []\n", "no rules"),
+		Entry("unknown fields", "rules:\n- match: {name: {glob: a}}\n  namespace: team-a\n", `unknown field "namespace"`),
+		Entry("missing matches", "rules:\n- namespaces: [team-a]\n", "rules[0]: match needs a name or tags"),
+		Entry("ambiguous patterns", "rules:\n- match: {name: {glob: a, regex: a}}\n", "rules[0]: match.name: exactly one of glob and regex is required"),
+		Entry("invalid regexes", "rules:\n- match: {tags: {team: {regex: '('}}}\n", "rules[0]: match.tags[team]: error parsing regexp"),
+		Entry("invalid templates", "rules:\n- match: {name: {glob: a}}\n  nameTemplate: '{{ .Name'\n", "rules[0]: nameTemplate:"),
+		Entry("invalid namespaces", "rules:\n- match: {name: {glob: a}}\n  namespaces: [Team_A]\n", `rules[0]: invalid namespace "Team_A"`),
+		Entry("reserved labels", "rules:\n- match: {name: {glob: a}}\n  labels: {managed-by: me}\n", "rules[0]: labels: managed-by is set by the Lambda"),
+	)
+})
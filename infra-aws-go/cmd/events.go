@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Secrets Manager events handled by the Lambda
+const (
+	EventPutSecretValue    = "PutSecretValue"
+	EventUpdateSecret      = "UpdateSecret"
+	EventRotationSucceeded = "RotationSucceeded"
+	EventDeleteSecret      = "DeleteSecret"
+	EventRestoreSecret     = "RestoreSecret"
+	EventTagResource       = "TagResource"
+	EventUntagResource     = "UntagResource"
+)
+
+// DeletePolicy is what happens to the Kubernetes Secrets of a deleted AWS
+// secret
+type DeletePolicy string
+
+const (
+	// DeletePolicyDelete deletes the Secrets
+	DeletePolicyDelete DeletePolicy = "delete"
+	// DeletePolicyRetain leaves the Secrets untouched
+	DeletePolicyRetain DeletePolicy = "retain"
+	// DeletePolicyOrphan keeps the Secrets and marks them with OrphanedAnnotation
+	DeletePolicyOrphan DeletePolicy = "orphan"
+)
+
+const (
+	// ManagedByLabel is set to ManagedByValue on every Secret the Lambda creates
+	ManagedByLabel = "managed-by"
+	ManagedByValue = "aws-secrets-sync-lambda"
+
+	// OrphanedAnnotation records, in RFC 3339, when the AWS secret of a Secret
+	// was deleted. It is removed again when the secret is restored.
+	OrphanedAnnotation = "aws-secrets-sync-lambda/orphaned-at"
+
+	// SyncKeyAnnotation records the event ID and secret version ID last
+	// written to a Secret, so retries of an event do not write it again
+	SyncKeyAnnotation = "aws-secrets-sync-lambda/sync-key"
+)
+
+// secretNameFromID returns the name of a secret identified by name or ARN.
+// Secret ARNs end with "secret:<name>-<6 random characters>".
+func secretNameFromID(secretID string) string {
+	parsed, err := arn.Parse(secretID)
+	if err != nil {
+		return secretID
+	}
+	name := strings.TrimPrefix(parsed.Resource, "secret:")
+	if i := strings.LastIndex(name, "-"); i > 0 && len(name)-i == 7 {
+		name = name[:i]
+	}
+	return name
+}
+
+// handleDeletedSecret applies the delete policy to the Kubernetes Secrets of a
+// deleted AWS secret, and records the outcome in result. Secrets not managed
+// by the Lambda are left alone.
+func (h *Handler) handleDeletedSecret(ctx context.Context, result *Result) error {
+	if h.cfg.DeletePolicy == DeletePolicyRetain {
+		logFrom(ctx).Info("Retaining Kubernetes secrets of deleted secret")
+		return nil
+	}
+
+	awsName, tags, err := describeDeletedSecret(ctx, h.secrets, result.SecretID)
+	if err != nil {
+		return fmt.Errorf("failed to describe secret: %w", err)
+	}
+	clusters := resolveClusters(h.cfg, tags)
+	targets, err := resolveTargets(h.cfg, awsName, tags)
+	if err != nil {
+		return fmt.Errorf("failed to resolve targets: %w", err)
+	}
+	if len(targets) == 0 {
+		logFrom(ctx).Info("Secret matches no routing rule, skipping")
+		return nil
+	}
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	result.Clusters = h.forEachCluster(ctx, clusters, func(ctx context.Context, cluster string) ([]TargetResult, error) {
+		k8sClient, err := h.clusters.Kubernetes(ctx, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+		}
+
+		var results []TargetResult
+		for _, target := range targets {
+			outcome, err := deleteKubernetesSecret(ctx, k8sClient, h.cfg.DeletePolicy, target)
+			results = append(results, newTargetResult(target.Namespace, target.Name, outcome, err))
+		}
+		return results, nil
+	})
+	return nil
+}
+
+// describeDeletedSecret is describeSecret for secrets that may be gone. A
+// secret scheduled for deletion can still be described; one deleted without
+// recovery only leaves its name behind.
+func describeDeletedSecret(ctx context.Context, svc SecretsManagerAPI, secretID string) (string, map[string]string, error) {
+	name, tags, err := describeSecret(ctx, svc, secretID)
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return secretNameFromID(secretID), nil, nil
+	}
+	return name, tags, err
+}
+
+// deleteKubernetesSecret deletes or orphans the Secret of target
+func deleteKubernetesSecret(ctx context.Context, client kubernetes.Interface, policy DeletePolicy, target SyncTarget) (Outcome, error) {
+	log := logFrom(ctx).With("namespace", target.Namespace, "name", target.Name)
+	secretsClient := client.CoreV1().Secrets(target.Namespace)
+
+	// The resource version makes the write fail with a conflict when the
+	// Secret changes after the ownership check
+	var outcome Outcome
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		outcome = OutcomeFailed
+		secret, err := secretsClient.Get(ctx, target.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			outcome = OutcomeSkipped
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if owner := secretOwner(secret); owner != "" {
+			log.Info("Secret is managed by someone else, skipping", "owner", owner)
+			outcome = OutcomeSkipped
+			return nil
+		}
+
+		switch policy {
+		case DeletePolicyDelete:
+			err := secretsClient.Delete(ctx, target.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{ResourceVersion: &secret.ResourceVersion},
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			log.Info("Deleted secret")
+			outcome = OutcomeDeleted
+		case DeletePolicyOrphan:
+			outcome = OutcomeOrphaned
+			if _, ok := secret.Annotations[OrphanedAnnotation]; ok {
+				return nil
+			}
+			// Applied by the same field manager as the data, so the next sync
+			// removes the annotation again. The type of a Secret can not change.
+			target.Type = secret.Type
+			orphaned := managedSecret(target, secret.Data).
+				WithResourceVersion(secret.ResourceVersion).
+				WithAnnotations(map[string]string{OrphanedAnnotation: time.Now().UTC().Format(time.RFC3339)})
+			if _, err := secretsClient.Apply(ctx, orphaned, metav1.ApplyOptions{FieldManager: FieldManager, Force: true}); err != nil {
+				outcome = OutcomeFailed
+				return err
+			}
+			log.Info("Marked secret as orphaned")
+		}
+		return nil
+	})
+	return outcome, err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Secrets Manager events", func() {
+	DescribeTable("SecretID",
+		func(detail, expected string) {
+			var d SecretsManagerEventDetail
+			Expect(json.Unmarshal([]byte(detail), &d)).To(Succeed())
+			Expect(d.SecretID()).To(Equal(expected))
+		},
+		Entry("API call", `{"eventName":"PutSecretValue","requestParameters":{"secretId":"eks-sync-app"}}`, "eks-sync-app"),
+		Entry("rotation", `{"eventName":"RotationSucceeded","requestParameters":null,"additionalEventData":{"SecretId":"eks-sync-app"}}`, "eks-sync-app"),
+	)
+
+	DescribeTable("secretNameFromID",
+		func(id, expected string) {
+			Expect(secretNameFromID(id)).To(Equal(expected))
+		},
+		Entry("name", "eks-sync-team/prod/app", "eks-sync-team/prod/app"),
+		Entry("ARN", "arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-app-AbCdEf", "eks-sync-app"),
+		Entry("partial ARN", "arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-app", "eks-sync-app"),
+	)
+
+	Context("deleteKubernetesSecret", func() {
+		var (
+			ctx    context.Context
+			target = SyncTarget{Namespace: "default", Name: "app"}
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+		})
+
+		secret := func(labels map[string]string) *corev1.Secret {
+			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Labels: labels}}
+		}
+
+		It("Should delete managed Secrets", func() {
+			client := fake.NewClientset(secret(map[string]string{ManagedByLabel: ManagedByValue}))
+			Expect(deleteKubernetesSecret(ctx, client, DeletePolicyDelete, target)).To(Equal(OutcomeDeleted))
+			_, err := client.CoreV1().Secrets("default").Get(ctx, "app", metav1.GetOptions{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("Should annotate managed Secrets as orphaned", func() {
+			client := fake.NewClientset(secret(map[string]string{ManagedByLabel: ManagedByValue}))
+			Expect(deleteKubernetesSecret(ctx, client, DeletePolicyOrphan, target)).To(Equal(OutcomeOrphaned))
+			got, err := client.CoreV1().Secrets("default").Get(ctx, "app", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got.Annotations).To(HaveKey(OrphanedAnnotation))
+		})
+
+		It("Should leave Secrets it does not manage alone", func() {
+			client := fake.NewClientset(secret(nil))
+			Expect(deleteKubernetesSecret(ctx, client, DeletePolicyDelete, target)).To(Equal(OutcomeSkipped))
+			_, err := client.CoreV1().Secrets("default").Get(ctx, "app", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should ignore Secrets that do not exist", func() {
+			Expect(deleteKubernetesSecret(ctx, fake.NewClientset(), DeletePolicyDelete, target)).To(Equal(OutcomeSkipped))
+		})
+	})
+})
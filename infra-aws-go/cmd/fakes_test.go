@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeSecret is an AWS secret held by fakeSecretsManager
+type fakeSecret struct {
+	Name      string
+	Value     string
+	VersionID string
+	Tags      map[string]string
+}
+
+// ARN returns the ARN of the secret, with the random suffix of real ARNs
+func (s *fakeSecret) ARN() string {
+	return "arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:" + s.Name + "-AbCdEf"
+}
+
+// fakeSecretsManager is an in-memory SecretsManagerAPI. It lists pageSize
+// secrets per page and records the operations called.
+type fakeSecretsManager struct {
+	mu       sync.Mutex
+	secrets  []*fakeSecret
+	pageSize int
+	// getErr is returned by GetSecretValue when set
+	getErr error
+	calls  []string
+}
+
+var _ SecretsManagerAPI = &fakeSecretsManager{}
+
+func (f *fakeSecretsManager) find(id string) (*fakeSecret, error) {
+	for _, secret := range f.secrets {
+		if id == secret.Name || id == secret.ARN() {
+			return secret, nil
+		}
+	}
+	return nil, &smtypes.ResourceNotFoundException{Message: aws.String("Secrets Manager can't find the specified secret.")}
+}
+
+func (f *fakeSecretsManager) DescribeSecret(_ context.Context, params *secretsmanager.DescribeSecretInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "DescribeSecret")
+
+	secret, err := f.find(aws.ToString(params.SecretId))
+	if err != nil {
+		return nil, err
+	}
+	return &secretsmanager.DescribeSecretOutput{ARN: aws.String(secret.ARN()), Name: aws.String(secret.Name), Tags: awsTags(secret.Tags)}, nil
+}
+
+func (f *fakeSecretsManager) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "GetSecretValue")
+
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	secret, err := f.find(aws.ToString(params.SecretId))
+	if err != nil {
+		return nil, err
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          aws.String(secret.ARN()),
+		Name:         aws.String(secret.Name),
+		SecretString: aws.String(secret.Value),
+		VersionId:    aws.String(secret.VersionID),
+	}, nil
+}
+
+func (f *fakeSecretsManager) ListSecrets(_ context.Context, params *secretsmanager.ListSecretsInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "ListSecrets")
+
+	start := 0
+	if params.NextToken != nil {
+		var err error
+		if start, err = strconv.Atoi(*params.NextToken); err != nil {
+			return nil, err
+		}
+	}
+	end := min(start+max(f.pageSize, 1), len(f.secrets))
+
+	output := &secretsmanager.ListSecretsOutput{}
+	for _, secret := range f.secrets[start:end] {
+		output.SecretList = append(output.SecretList, smtypes.SecretListEntry{
+			ARN:                    aws.String(secret.ARN()),
+			Name:                   aws.String(secret.Name),
+			Tags:                   awsTags(secret.Tags),
+			SecretVersionsToStages: map[string][]string{secret.VersionID: {currentStage}},
+		})
+	}
+	if end < len(f.secrets) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func awsTags(tags map[string]string) []smtypes.Tag {
+	var awsTags []smtypes.Tag
+	for key, value := range tags {
+		awsTags = append(awsTags, smtypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return awsTags
+}
+
+// fakeClusters is Clusters over fake clients. Clusters without clients are
+// unreachable.
+type fakeClusters struct {
+	kubernetes map[string]*fake.Clientset
+	dynamic    map[string]*dynamicfake.FakeDynamicClient
+}
+
+var _ Clusters = &fakeClusters{}
+
+func (f *fakeClusters) Kubernetes(_ context.Context, cluster string) (kubernetes.Interface, error) {
+	if client, ok := f.kubernetes[cluster]; ok {
+		return client, nil
+	}
+	return nil, fmt.Errorf("cluster %s is unreachable", cluster)
+}
+
+func (f *fakeClusters) Dynamic(_ context.Context, cluster string) (dynamic.Interface, error) {
+	if client, ok := f.dynamic[cluster]; ok {
+		return client, nil
+	}
+	return nil, fmt.Errorf("cluster %s is unreachable", cluster)
+}
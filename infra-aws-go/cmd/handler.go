@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SecretsManagerAPI is the part of the Secrets Manager client the Lambda uses
+type SecretsManagerAPI interface {
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	secretsmanager.ListSecretsAPIClient
+}
+
+// EKSAPI is the part of the EKS client the Lambda uses
+type EKSAPI interface {
+	DescribeCluster(ctx context.Context, params *eks.DescribeClusterInput, optFns ...func(*eks.Options)) (*eks.DescribeClusterOutput, error)
+}
+
+// Clusters returns the clients of the EKS clusters secrets are synced to
+type Clusters interface {
+	// Kubernetes returns the clientset of cluster
+	Kubernetes(ctx context.Context, cluster string) (kubernetes.Interface, error)
+	// Dynamic returns the dynamic client of cluster, for SecretManagers
+	Dynamic(ctx context.Context, cluster string) (dynamic.Interface, error)
+}
+
+// Handler handles the events of the Lambda with the clients it was created
+// with
+type Handler struct {
+	cfg      Config
+	secrets  SecretsManagerAPI
+	clusters Clusters
+}
+
+// NewHandler returns a Handler. main passes the AWS clients and the EKS
+// connections kept across warm invocations; tests pass fakes.
+func NewHandler(cfg Config, secrets SecretsManagerAPI, clusters Clusters) *Handler {
+	return &Handler{cfg: cfg, secrets: secrets, clusters: clusters}
+}
+
+// Handle is the Lambda handler function. Schedule rules trigger a resync;
+// Secrets Manager events a sync of one secret.
+func (h *Handler) Handle(ctx context.Context, event events.CloudWatchEvent) (Result, error) {
+	if event.DetailType == ScheduledEventType {
+		return h.HandleResync(ctx, event)
+	}
+	return h.HandleRequest(ctx, event)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		ctx      context.Context
+		cfg      Config
+		secrets  *fakeSecretsManager
+		clusters *fakeClusters
+		app      *fakeSecret
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cfg = Config{
+			EKSClusterNames: []string{"dev", "prod"},
+			MaxConcurrency:  4,
+			Region:          "ap-southeast-1",
+			SecretPrefix:    "eks-sync-",
+			Namespace:       "default",
+			Routing:         defaultRouting("eks-sync-", "default"),
+			SyncMode:        SyncModeWrite,
+			DeletePolicy:    DeletePolicyOrphan,
+			OwnershipPolicy: OwnershipPolicyRefuse,
+
+			AllowedNamespaces: []string{"team-a", "team-b"},
+		}
+		Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+
+		app = &fakeSecret{Name: "eks-sync-app", Value: `{"username":"admin","password":"s3cr3t"}`, VersionID: "v1"}
+		secrets = &fakeSecretsManager{secrets: []*fakeSecret{app}}
+		clusters = &fakeClusters{kubernetes: map[string]*fake.Clientset{
+			"dev":  fake.NewClientset(),
+			"prod": fake.NewClientset(),
+		}}
+	})
+
+	handle := func(event events.CloudWatchEvent) (Result, error) {
+		return NewHandler(cfg, secrets, clusters).Handle(ctx, event)
+	}
+
+	// apiEvent is a CloudTrail event of a Secrets Manager API call
+	apiEvent := func(eventName, secretID string) events.CloudWatchEvent {
+		detail, err := json.Marshal(map[string]any{
+			"eventSource":       "secretsmanager.amazonaws.com",
+			"eventName":         eventName,
+			"requestParameters": map[string]string{"secretId": secretID},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return events.CloudWatchEvent{ID: "event-1", DetailType: "AWS API Call via CloudTrail", Source: "aws.secretsmanager", Detail: detail}
+	}
+
+	// serviceEvent is a Secrets Manager event without request parameters
+	serviceEvent := func(eventName, secretID string) events.CloudWatchEvent {
+		detail, err := json.Marshal(map[string]any{
+			"eventSource":         "secretsmanager.amazonaws.com",
+			"eventName":           eventName,
+			"additionalEventData": map[string]string{"SecretId": secretID},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return events.CloudWatchEvent{ID: "event-1", DetailType: "AWS Service Event via CloudTrail", Source: "aws.secretsmanager", Detail: detail}
+	}
+
+	getSecret := func(cluster, name string) (*corev1.Secret, error) {
+		return clusters.kubernetes[cluster].CoreV1().Secrets("default").Get(ctx, name, metav1.GetOptions{})
+	}
+
+	// outcomes returns the outcome of every target of result by cluster
+	outcomes := func(result Result) map[string][]Outcome {
+		byCluster := map[string][]Outcome{}
+		for _, cluster := range result.Clusters {
+			byCluster[cluster.Cluster] = []Outcome{}
+			for _, target := range cluster.Targets {
+				byCluster[cluster.Cluster] = append(byCluster[cluster.Cluster], target.Outcome)
+			}
+		}
+		return byCluster
+	}
+
+	DescribeTable("events syncing the secret",
+		func(event events.CloudWatchEvent) {
+			result, err := handle(event)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.VersionID).To(Equal("v1"))
+			Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+				"dev":  {OutcomeCreated},
+				"prod": {OutcomeCreated},
+			}))
+
+			for _, cluster := range cfg.EKSClusterNames {
+				secret, err := getSecret(cluster, "eks-sync-app")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(secret.Data).To(Equal(map[string][]byte{"username": []byte("admin"), "password": []byte("s3cr3t")}))
+				Expect(secret.Annotations).To(HaveKeyWithValue(SyncKeyAnnotation, "event-1/v1"))
+			}
+		},
+		Entry("PutSecretValue", apiEvent(EventPutSecretValue, "eks-sync-app")),
+		Entry("UpdateSecret by ARN", apiEvent(EventUpdateSecret, "arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-app-AbCdEf")),
+		Entry("RotationSucceeded", serviceEvent(EventRotationSucceeded, "eks-sync-app")),
+		Entry("TagResource", apiEvent(EventTagResource, "eks-sync-app")),
+		Entry("UntagResource", apiEvent(EventUntagResource, "eks-sync-app")),
+		Entry("RestoreSecret", apiEvent(EventRestoreSecret, "eks-sync-app")),
+	)
+
+	It("Should not write again when an event is retried", func() {
+		_, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+			"dev":  {OutcomeUnchanged},
+			"prod": {OutcomeUnchanged},
+		}))
+	})
+
+	It("Should sync only to the clusters and namespaces in the tags", func() {
+		app.Tags = map[string]string{ClustersTag: "prod", NamespaceTag: "team-a team-b"}
+		result, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Clusters).To(Equal([]ClusterResult{{Cluster: "prod", Targets: []TargetResult{
+			{Namespace: "team-a", Name: "eks-sync-app", Outcome: OutcomeCreated},
+			{Namespace: "team-b", Name: "eks-sync-app", Outcome: OutcomeCreated},
+		}}}))
+		_, err = getSecret("dev", "eks-sync-app")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should report clusters in the tags that are not configured", func() {
+		app.Tags = map[string]string{ClustersTag: "prod staging"}
+		result, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+
+		var resultErr *ResultError
+		Expect(errors.As(err, &resultErr)).To(BeTrue())
+		Expect(result.Clusters).To(Equal([]ClusterResult{
+			{Cluster: "prod", Targets: []TargetResult{{Namespace: "default", Name: "eks-sync-app", Outcome: OutcomeCreated}}},
+			{Cluster: "staging", Error: "cluster staging is not one of EKS_CLUSTER_NAMES"},
+		}))
+	})
+
+	It("Should refuse namespaces in the tags that are not allowed", func() {
+		app.Tags = map[string]string{NamespaceTag: "team-a kube-system"}
+		_, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).To(MatchError(ContainSubstring("namespace 'kube-system' of secret 'eks-sync-app' is not in ALLOWED_NAMESPACES")))
+		for _, cluster := range cfg.EKSClusterNames {
+			_, err := getSecret(cluster, "eks-sync-app")
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	It("Should skip secrets no routing rule matches without calling AWS", func() {
+		result, err := handle(apiEvent(EventPutSecretValue, "other-app"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Clusters).To(BeEmpty())
+		Expect(secrets.calls).To(BeEmpty())
+	})
+
+	It("Should ignore other events", func() {
+		result, err := handle(apiEvent("GetSecretValue", "eks-sync-app"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Clusters).To(BeEmpty())
+		Expect(secrets.calls).To(BeEmpty())
+	})
+
+	It("Should fail on events it can not parse", func() {
+		_, err := handle(events.CloudWatchEvent{ID: "event-1", Detail: json.RawMessage(`"not an object"`)})
+		Expect(err).To(MatchError(ContainSubstring("failed to parse event detail")))
+	})
+
+	It("Should fail when the secret value can not be read", func() {
+		secrets.getErr = errors.New("access denied")
+		_, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).To(MatchError(ContainSubstring("access denied")))
+	})
+
+	It("Should carry on past unreachable clusters and report them", func() {
+		delete(clusters.kubernetes, "dev")
+		result, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+
+		var resultErr *ResultError
+		Expect(errors.As(err, &resultErr)).To(BeTrue())
+		Expect(resultErr.Result).To(Equal(result))
+		Expect(result.Clusters[0].Error).To(ContainSubstring("cluster dev is unreachable"))
+		Expect(outcomes(result)["prod"]).To(Equal([]Outcome{OutcomeCreated}))
+	})
+
+	It("Should refuse Secrets managed by someone else", func() {
+		Expect(clusters.kubernetes["prod"].Tracker().Add(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "eks-sync-app", Namespace: "default"},
+		})).To(Succeed())
+		result, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).To(BeAssignableToTypeOf(&ResultError{}))
+		Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+			"dev":  {OutcomeCreated},
+			"prod": {OutcomeRefused},
+		}))
+	})
+
+	Context("DeleteSecret", func() {
+		BeforeEach(func() {
+			_, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should orphan the Secrets by default", func() {
+			result, err := handle(apiEvent(EventDeleteSecret, "eks-sync-app"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+				"dev":  {OutcomeOrphaned},
+				"prod": {OutcomeOrphaned},
+			}))
+			secret, err := getSecret("prod", "eks-sync-app")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Annotations).To(HaveKey(OrphanedAnnotation))
+		})
+
+		It("Should delete the Secrets of secrets deleted without recovery", func() {
+			cfg.DeletePolicy = DeletePolicyDelete
+			secrets.secrets = nil
+			result, err := handle(apiEvent(EventDeleteSecret, app.ARN()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+				"dev":  {OutcomeDeleted},
+				"prod": {OutcomeDeleted},
+			}))
+			_, err = getSecret("prod", "eks-sync-app")
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("Should retain the Secrets without calling AWS", func() {
+			cfg.DeletePolicy = DeletePolicyRetain
+			secrets.calls = nil
+			result, err := handle(apiEvent(EventDeleteSecret, "eks-sync-app"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Clusters).To(BeEmpty())
+			Expect(secrets.calls).To(BeEmpty())
+			_, err = getSecret("prod", "eks-sync-app")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	It("Should nudge the operator in nudge mode", func() {
+		cfg.SyncMode = SyncModeNudge
+		scheme := runtime.NewScheme()
+		Expect(mydomainv2.AddToScheme(scheme)).To(Succeed())
+		newClient := func() *dynamicfake.FakeDynamicClient {
+			return dynamicfake.NewSimpleDynamicClient(scheme, &mydomainv2.SecretManager{
+				TypeMeta:   metav1.TypeMeta{APIVersion: mydomainv2.GroupVersion.String(), Kind: "SecretManager"},
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: mydomainv2.SecretManagerSpec{
+					Target:   mydomainv2.SecretTarget{Name: "app"},
+					StoreRef: &mydomainv2.StoreRef{Region: "ap-southeast-1"},
+					Sources:  []mydomainv2.SecretSource{{SecretName: "eks-sync-app"}},
+				},
+			})
+		}
+		clusters.dynamic = map[string]*dynamicfake.FakeDynamicClient{"dev": newClient(), "prod": newClient()}
+
+		result, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+			"dev":  {OutcomeNudged},
+			"prod": {OutcomeNudged},
+		}))
+		Expect(secrets.calls).NotTo(ContainElement("GetSecretValue"))
+		_, err = getSecret("prod", "eks-sync-app")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should resync every routed secret on scheduled events", func() {
+		secrets.pageSize = 1
+		secrets.secrets = append(secrets.secrets,
+			&fakeSecret{Name: "other-app", Value: "x", VersionID: "v1"},
+			&fakeSecret{Name: "eks-sync-db", Value: "x", VersionID: "v3", Tags: map[string]string{ClustersTag: "prod"}},
+		)
+		_, err := handle(apiEvent(EventPutSecretValue, "eks-sync-app"))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := handle(events.CloudWatchEvent{ID: "schedule-1", DetailType: ScheduledEventType, Source: "aws.events"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.EventName).To(Equal(EventResync))
+		Expect(outcomes(result)).To(Equal(map[string][]Outcome{
+			"dev":  {OutcomeUnchanged},
+			"prod": {OutcomeUnchanged, OutcomeCreated},
+		}))
+		secret, err := getSecret("prod", "eks-sync-db")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Annotations).To(HaveKeyWithValue(SyncKeyAnnotation, "schedule-1/v3"))
+	})
+})
@@ -4,253 +4,251 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
-	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
-)
+	"k8s.io/client-go/util/retry"
 
-// Configuration from environment variables
-type Config struct {
-	EKSClusterName string
-	Region         string
-	SecretPrefix   string // Naming convention prefix (e.g., "eks-sync-")
-	Namespace      string // Default kubernetes namespace
-}
+	"github.com/huonguyenlt/secret-manager/pkg/secretdata"
+)
 
 // SecretsManagerEvent represents the CloudWatch Event from Secrets Manager
 type SecretsManagerEventDetail struct {
 	EventSource       string `json:"eventSource"`
 	EventName         string `json:"eventName"`
 	RequestParameters struct {
-		SecretId string `json:"secretId"`
+		SecretId                   string `json:"secretId"`
+		ForceDeleteWithoutRecovery bool   `json:"forceDeleteWithoutRecovery"`
 	} `json:"requestParameters"`
+	// Service events such as RotationSucceeded have no request parameters
+	AdditionalEventData struct {
+		SecretId string `json:"SecretId"`
+	} `json:"additionalEventData"`
 }
 
-func main() {
-	lambda.Start(HandleRequest)
+// SecretID returns the name or ARN of the secret the event is about
+func (d SecretsManagerEventDetail) SecretID() string {
+	if d.RequestParameters.SecretId != "" {
+		return d.RequestParameters.SecretId
+	}
+	return d.AdditionalEventData.SecretId
 }
 
-// HandleRequest is the Lambda handler function
-func HandleRequest(ctx context.Context, event events.CloudWatchEvent) error {
-	fmt.Printf("Processing event: %s\n", event.DetailType)
+func main() {
+	slog.SetDefault(newLogger())
 
-	// Step 1: Load configuration from environment variables
-	cfg := loadConfig()
+	// Step 1: Load configuration from environment variables. An invalid
+	// configuration fails the init phase instead of every invocation.
+	cfg, err := loadConfig(context.Background(), os.Getenv)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// The clients are kept across warm invocations
+	awsCfg, err := loadAWSConfig(context.Background(), cfg.Region)
+	if err != nil {
+		slog.Error("Failed to load AWS configuration", "error", err)
+		os.Exit(1)
+	}
+	handler := NewHandler(cfg, secretsmanager.NewFromConfig(awsCfg), newEKSClusters(eks.NewFromConfig(awsCfg)))
+
+	lambda.Start(handler.Handle)
+}
+
+// HandleRequest handles Secrets Manager events. It returns the outcome for
+// every target, and a ResultError holding them when any target failed.
+func (h *Handler) HandleRequest(ctx context.Context, event events.CloudWatchEvent) (Result, error) {
+	log := eventLogger(ctx, event.ID)
+	log.Info("Processing event", "detailType", event.DetailType)
 
 	// Step 2: Parse the CloudWatch event to get secret details
 	var detail SecretsManagerEventDetail
 	if err := json.Unmarshal(event.Detail, &detail); err != nil {
-		return fmt.Errorf("failed to parse event detail: %w", err)
+		return Result{EventID: event.ID}, fmt.Errorf("failed to parse event detail: %w", err)
 	}
 
-	secretName := detail.RequestParameters.SecretId
-	fmt.Printf("Secret name from event: %s\n", secretName)
+	secretID := detail.SecretID()
+	secretName := secretNameFromID(secretID)
+	result := Result{EventID: event.ID, EventName: detail.EventName, SecretID: secretID}
+	log = log.With("eventName", detail.EventName, "secretId", secretID)
+	ctx = withLogger(ctx, log)
 
-	// Step 3: Check if secret matches naming convention
-	if !strings.HasPrefix(secretName, cfg.SecretPrefix) {
-		fmt.Printf("Secret '%s' does not match prefix '%s', skipping\n", secretName, cfg.SecretPrefix)
-		return nil
+	// Step 3: Check if a routing rule may match the secret. Rules on tags are
+	// only decided once the secret is described.
+	if !h.cfg.Routing.mayMatch(secretName) {
+		log.Info("Secret matches no routing rule, skipping")
+		return result, nil
 	}
 
-	// Step 4: Retrieve secret value from AWS Secrets Manager
-	secretData, err := getSecretFromAWS(ctx, cfg.Region, secretName)
-	if err != nil {
-		return fmt.Errorf("failed to get secret from AWS: %w", err)
+	// Step 4: React to the event
+	var err error
+	switch detail.EventName {
+	case EventPutSecretValue, EventUpdateSecret, EventRotationSucceeded,
+		EventTagResource, EventUntagResource, EventRestoreSecret:
+		if h.cfg.SyncMode == SyncModeNudge {
+			err = h.nudgeOperator(ctx, &result)
+		} else {
+			err = h.syncSecret(ctx, &result)
+		}
+	case EventDeleteSecret:
+		if h.cfg.SyncMode == SyncModeNudge {
+			err = h.nudgeOperator(ctx, &result)
+		} else {
+			err = h.handleDeletedSecret(ctx, &result)
+		}
+	default:
+		log.Info("Ignoring event")
+		return result, nil
 	}
-
-	// Step 5: Initialize Kubernetes client for EKS
-	k8sClient, err := getKubernetesClient(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create kubernetes client: %w", err)
+		log.Error("Event failed", "error", err)
+		return result, err
 	}
 
-	// Step 6: Update the Kubernetes secret with the same name
-	if err := updateKubernetesSecret(ctx, k8sClient, cfg.Namespace, secretName, secretData); err != nil {
-		return fmt.Errorf("failed to update kubernetes secret: %w", err)
+	logResults(ctx, result.Clusters)
+	if result.Failed() {
+		return result, &ResultError{Result: result}
 	}
-
-	fmt.Printf("Successfully synced secret '%s' to EKS cluster\n", secretName)
-	return nil
+	return result, nil
 }
 
-// Step 1: Load configuration from environment variables
-func loadConfig() Config {
-	cfg := Config{
-		EKSClusterName: os.Getenv("EKS_CLUSTER_NAME"),
-		Region:         os.Getenv("AWS_REGION"),
-		SecretPrefix:   os.Getenv("SECRET_PREFIX"),
-		Namespace:      os.Getenv("K8S_NAMESPACE"),
-	}
-
-	// Set defaults
-	if cfg.Region == "" {
-		cfg.Region = "us-east-1"
+// syncSecret writes the value of an AWS secret to its Kubernetes Secrets, and
+// records the outcome in result
+func (h *Handler) syncSecret(ctx context.Context, result *Result) error {
+	// Step 5: Resolve the Kubernetes Secrets to write from the secret tags
+	awsName, tags, err := describeSecret(ctx, h.secrets, result.SecretID)
+	if err != nil {
+		return fmt.Errorf("failed to describe secret: %w", err)
 	}
-	if cfg.SecretPrefix == "" {
-		cfg.SecretPrefix = "eks-sync-"
+	clusters := resolveClusters(h.cfg, tags)
+	targets, err := resolveTargets(h.cfg, awsName, tags)
+	if err != nil {
+		return fmt.Errorf("failed to resolve targets: %w", err)
 	}
-	if cfg.Namespace == "" {
-		cfg.Namespace = "default"
+	if len(targets) == 0 {
+		logFrom(ctx).Info("Secret matches no routing rule, skipping")
+		return nil
 	}
-
-	if cfg.EKSClusterName == "" {
-		panic("EKS_CLUSTER_NAME environment variable is required")
+	if len(clusters) == 0 {
+		return nil
 	}
 
-	fmt.Printf("Configuration loaded: ClusterName=%s, Region=%s, Prefix=%s, Namespace=%s\n",
-		cfg.EKSClusterName, cfg.Region, cfg.SecretPrefix, cfg.Namespace)
-
-	return cfg
-}
-
-// Step 4: Retrieve secret value from AWS Secrets Manager
-func getSecretFromAWS(ctx context.Context, region, secretName string) (map[string][]byte, error) {
-	fmt.Printf("Retrieving secret '%s' from AWS Secrets Manager\n", secretName)
-
-	// Load AWS SDK configuration
-	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	// Step 6: Retrieve secret value from AWS Secrets Manager
+	secretData, versionID, err := getSecretFromAWS(ctx, h.secrets, result.SecretID, secretdata.Options{Separator: h.cfg.FlattenSeparator})
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return fmt.Errorf("failed to get secret from AWS: %w", err)
 	}
+	result.VersionID = versionID
 
-	// Create Secrets Manager client
-	svc := secretsmanager.NewFromConfig(awsCfg)
-
-	// Get the secret value
-	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-		SecretId: &secretName,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get secret value: %w", err)
-	}
+	// A retry of the event finds this key on the Secrets it already wrote
+	syncKey := result.EventID + "/" + versionID
 
-	// Parse secret string as JSON (common format)
-	secretData := make(map[string][]byte)
-	if result.SecretString != nil {
-		var jsonData map[string]interface{}
-		if err := json.Unmarshal([]byte(*result.SecretString), &jsonData); err != nil {
-			// If not JSON, store as single key-value
-			secretData["secret"] = []byte(*result.SecretString)
-		} else {
-			// Convert JSON to map[string][]byte for Kubernetes secret
-			for key, value := range jsonData {
-				secretData[key] = []byte(fmt.Sprintf("%v", value))
-			}
+	// Steps 7 and 8: Update every target Secret in every cluster, carrying on
+	// past failures
+	result.Clusters = h.forEachCluster(ctx, clusters, func(ctx context.Context, cluster string) ([]TargetResult, error) {
+		k8sClient, err := h.clusters.Kubernetes(ctx, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 		}
-	} else if result.SecretBinary != nil {
-		// Handle binary secrets
-		secretData["secret"] = result.SecretBinary
-	}
 
-	fmt.Printf("Retrieved secret with %d key(s)\n", len(secretData))
-	return secretData, nil
+		var results []TargetResult
+		for _, target := range targets {
+			outcome, err := updateKubernetesSecret(ctx, k8sClient, h.cfg.OwnershipPolicy, target, secretData, syncKey)
+			results = append(results, newTargetResult(target.Namespace, target.Name, outcome, err))
+		}
+		return results, nil
+	})
+	return nil
 }
 
-// Step 5: Initialize Kubernetes client for EKS
-func getKubernetesClient(ctx context.Context, cfg Config) (*kubernetes.Clientset, error) {
-	fmt.Printf("Connecting to EKS cluster '%s'\n", cfg.EKSClusterName)
+// Step 6: Retrieve secret value, and the ID of its version, from AWS Secrets
+// Manager
+func getSecretFromAWS(ctx context.Context, svc SecretsManagerAPI, secretName string, opts secretdata.Options) (map[string][]byte, string, error) {
+	log := logFrom(ctx)
+	log.Info("Retrieving secret from AWS Secrets Manager")
 
-	// Load AWS SDK configuration
-	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	// Get EKS cluster information
-	eksClient := eks.NewFromConfig(awsCfg)
-	clusterOutput, err := eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{
-		Name: &cfg.EKSClusterName,
+	// Get the secret value
+	result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &secretName,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe EKS cluster: %w", err)
-	}
-
-	cluster := clusterOutput.Cluster
-
-	// Generate authentication token using aws-iam-authenticator
-	gen, err := token.NewGenerator(true, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create token generator: %w", err)
+		return nil, "", fmt.Errorf("failed to get secret value: %w", err)
 	}
 
-	tok, err := gen.Get(cfg.EKSClusterName)
+	// Split the secret into keys exactly as the operator does
+	secretData, err := secretdata.Decode(result.SecretString, result.SecretBinary, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get authentication token: %w", err)
-	}
-
-	// Create Kubernetes rest config
-	k8sConfig := &rest.Config{
-		Host:        *cluster.Endpoint,
-		BearerToken: tok.Token,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData: cluster.CertificateAuthority.Data,
-		},
+		return nil, "", fmt.Errorf("failed to decode secret value: %w", err)
 	}
 
-	// Create Kubernetes clientset
-	clientset, err := kubernetes.NewForConfig(k8sConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-	}
-
-	fmt.Println("Successfully connected to EKS cluster")
-	return clientset, nil
+	log.Info("Retrieved secret", "keys", len(secretData), "versionId", aws.ToString(result.VersionId))
+	return secretData, aws.ToString(result.VersionId), nil
 }
 
-// Step 6: Update or create Kubernetes secret with the same name
-func updateKubernetesSecret(ctx context.Context, client *kubernetes.Clientset, namespace, secretName string, data map[string][]byte) error {
-	fmt.Printf("Updating Kubernetes secret '%s' in namespace '%s'\n", secretName, namespace)
-
-	secretsClient := client.CoreV1().Secrets(namespace)
-
-	// Check if secret already exists
-	existingSecret, err := secretsClient.Get(ctx, secretName, metav1.GetOptions{})
-
-	if err != nil {
-		// Secret doesn't exist, create it
-		fmt.Printf("Secret '%s' not found, creating new secret\n", secretName)
-
-		secret := &v1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      secretName,
-				Namespace: namespace,
-				Labels: map[string]string{
-					"managed-by": "aws-secrets-sync-lambda",
-				},
-			},
-			Type: v1.SecretTypeOpaque,
-			Data: data,
-		}
-
-		_, err = secretsClient.Create(ctx, secret, metav1.CreateOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to create secret: %w", err)
+// Step 8: Update or create Kubernetes secret. syncKey identifies the event
+// and secret version written, and is recorded in the SyncKeyAnnotation.
+func updateKubernetesSecret(ctx context.Context, client kubernetes.Interface, policy OwnershipPolicy, target SyncTarget, data map[string][]byte, syncKey string) (Outcome, error) {
+	log := logFrom(ctx).With("namespace", target.Namespace, "name", target.Name)
+	log.Info("Updating Kubernetes secret")
+
+	secretsClient := client.CoreV1().Secrets(target.Namespace)
+
+	// The resource version makes the apply fail with a conflict when the Secret
+	// changes between the ownership check and the write
+	var outcome Outcome
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		outcome = OutcomeFailed
+		secret := managedSecret(target, data)
+
+		existingSecret, err := secretsClient.Get(ctx, target.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			log.Info("Secret not found, creating new secret")
+			outcome = OutcomeCreated
+		case err != nil:
+			return fmt.Errorf("failed to get secret: %w", err)
+		default:
+			if existingSecret.Annotations[SyncKeyAnnotation] == syncKey {
+				log.Info("Secret already written by this event, skipping")
+				outcome = OutcomeUnchanged
+				return nil
+			}
+			outcome = OutcomeUpdated
+			secret.WithResourceVersion(existingSecret.ResourceVersion)
+			if owner := secretOwner(existingSecret); owner != "" {
+				if policy != OwnershipPolicyMerge {
+					outcome = OutcomeRefused
+					return fmt.Errorf("%w: managed by %s", ErrNotOwned, owner)
+				}
+				// Only the keys go in; the Secret stays with its owner, and
+				// keeps its labels and type
+				log.Info("Secret is managed by someone else, merging keys", "owner", owner)
+				secret = corev1ac.Secret(target.Name, target.Namespace).
+					WithResourceVersion(existingSecret.ResourceVersion).
+					WithData(data)
+			}
 		}
 
-		fmt.Printf("Successfully created secret '%s'\n", secretName)
-	} else {
-		// Secret exists, update it
-		fmt.Printf("Secret '%s' found, updating existing secret\n", secretName)
-
-		existingSecret.Data = data
-
-		_, err = secretsClient.Update(ctx, existingSecret, metav1.UpdateOptions{})
+		// Leaving out the orphaned annotation removes it, in case the AWS
+		// secret was deleted and restored
+		secret.WithAnnotations(map[string]string{SyncKeyAnnotation: syncKey})
+		_, err = secretsClient.Apply(ctx, secret, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
 		if err != nil {
-			return fmt.Errorf("failed to update secret: %w", err)
+			return fmt.Errorf("failed to apply secret: %w", err)
 		}
 
-		fmt.Printf("Successfully updated secret '%s'\n", secretName)
-	}
-
-	return nil
+		log.Info("Applied secret", "outcome", outcome)
+		return nil
+	})
+	return outcome, err
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+type loggerKey struct{}
+
+// newLogger returns the JSON logger the Lambda writes to CloudWatch with
+func newLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stdout, nil))
+}
+
+// eventLogger returns a logger correlating every line with the CloudWatch
+// event and the Lambda invocation
+func eventLogger(ctx context.Context, eventID string) *slog.Logger {
+	logger := slog.Default().With("eventId", eventID)
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		logger = logger.With("requestId", lc.AwsRequestID)
+	}
+	return logger
+}
+
+// withLogger returns a copy of ctx carrying logger
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// logFrom returns the logger of ctx, or the default logger
+func logFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
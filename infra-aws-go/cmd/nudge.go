@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+// SyncMode is how the Lambda brings a changed AWS secret into the clusters
+type SyncMode string
+
+const (
+	// SyncModeWrite writes the secret value to the Kubernetes Secrets
+	SyncModeWrite SyncMode = "write"
+	// SyncModeNudge writes no Secret data. It sets the ForceSyncAnnotation on
+	// the SecretManagers reading the secret, and the operator syncs them.
+	SyncModeNudge SyncMode = "nudge"
+)
+
+// secretManagerResource is the SecretManager resource of the operator
+var secretManagerResource = mydomainv2.GroupVersion.WithResource("secretmanagers")
+
+// nudgeOperator sets the ForceSyncAnnotation on the SecretManagers reading
+// an AWS secret, in every cluster the secret is synced to, and records the
+// outcome in result
+func (h *Handler) nudgeOperator(ctx context.Context, result *Result) error {
+	awsName, tags, err := describeDeletedSecret(ctx, h.secrets, result.SecretID)
+	if err != nil {
+		return fmt.Errorf("failed to describe secret: %w", err)
+	}
+	clusters := resolveClusters(h.cfg, tags)
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	result.Clusters = h.forEachCluster(ctx, clusters, func(ctx context.Context, cluster string) ([]TargetResult, error) {
+		client, err := h.clusters.Dynamic(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		return annotateSecretManagers(ctx, client, h.cfg.Region, awsName, result.EventID)
+	})
+	return nil
+}
+
+// annotateSecretManagers sets the ForceSyncAnnotation to the event ID on
+// every SecretManager reading the AWS secret secretName in region. Every event
+// changes the annotation and triggers a sync; retries of an event do not.
+// SecretManagers are listed in every namespace, so the Lambda needs get, list
+// and patch on secretmanagers cluster-wide.
+func annotateSecretManagers(ctx context.Context, client dynamic.Interface, region, secretName, eventID string) ([]TargetResult, error) {
+	list, err := client.Resource(secretManagerResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SecretManagers: %w", err)
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{mydomainv2.ForceSyncAnnotation: eventID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []TargetResult
+	for _, item := range list.Items {
+		var sm mydomainv2.SecretManager
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &sm); err != nil {
+			err = fmt.Errorf("failed to decode SecretManager: %w", err)
+			results = append(results, newTargetResult(item.GetNamespace(), item.GetName(), OutcomeFailed, err))
+			continue
+		}
+		if !readsSecret(&sm, region, secretName) {
+			continue
+		}
+		if sm.Annotations[mydomainv2.ForceSyncAnnotation] == eventID {
+			results = append(results, newTargetResult(sm.Namespace, sm.Name, OutcomeUnchanged, nil))
+			continue
+		}
+
+		_, err := client.Resource(secretManagerResource).Namespace(sm.Namespace).
+			Patch(ctx, sm.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		if err != nil {
+			err = fmt.Errorf("failed to annotate SecretManager: %w", err)
+			results = append(results, newTargetResult(sm.Namespace, sm.Name, OutcomeFailed, err))
+			continue
+		}
+		logFrom(ctx).Info("Nudged SecretManager", "namespace", sm.Namespace, "name", sm.Name)
+		results = append(results, newTargetResult(sm.Namespace, sm.Name, OutcomeNudged, nil))
+	}
+	return results, nil
+}
+
+// readsSecret reports whether a source of sm is the AWS secret secretName in
+// region. Sources name secrets by name or ARN, and take their region from
+// their own store, the ARN or the store of sm, in that order.
+func readsSecret(sm *mydomainv2.SecretManager, region, secretName string) bool {
+	for _, source := range sm.Spec.Sources {
+		sourceRegion := ""
+		if parsed, err := arn.Parse(source.SecretName); err == nil {
+			sourceRegion = parsed.Region
+		}
+		switch {
+		case source.StoreRef != nil:
+			sourceRegion = source.StoreRef.Region
+		case sourceRegion == "" && sm.Spec.StoreRef != nil:
+			sourceRegion = sm.Spec.StoreRef.Region
+		}
+
+		if secretNameFromID(source.SecretName) == secretName && (sourceRegion == "" || sourceRegion == region) {
+			return true
+		}
+	}
+	return false
+}
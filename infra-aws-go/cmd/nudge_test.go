@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+var _ = Describe("Operator nudges", func() {
+	secretManager := func(name string, storeRef *mydomainv2.StoreRef, sources ...mydomainv2.SecretSource) *mydomainv2.SecretManager {
+		return &mydomainv2.SecretManager{
+			TypeMeta:   metav1.TypeMeta{APIVersion: mydomainv2.GroupVersion.String(), Kind: "SecretManager"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: mydomainv2.SecretManagerSpec{
+				Target:   mydomainv2.SecretTarget{Name: name},
+				StoreRef: storeRef,
+				Sources:  sources,
+			},
+		}
+	}
+	prod := &mydomainv2.StoreRef{Region: "ap-southeast-1"}
+	other := &mydomainv2.StoreRef{Region: "us-east-1"}
+
+	DescribeTable("readsSecret",
+		func(sm *mydomainv2.SecretManager, expected bool) {
+			Expect(readsSecret(sm, "ap-southeast-1", "eks-sync-app")).To(Equal(expected))
+		},
+		Entry("by name", secretManager("a", prod, mydomainv2.SecretSource{SecretName: "eks-sync-app"}), true),
+		Entry("by ARN", secretManager("a", other, mydomainv2.SecretSource{
+			SecretName: "arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-app-AbCdEf",
+		}), true),
+		Entry("in a later source", secretManager("a", prod,
+			mydomainv2.SecretSource{SecretName: "eks-sync-base"},
+			mydomainv2.SecretSource{SecretName: "eks-sync-app"},
+		), true),
+		Entry("in another region", secretManager("a", other, mydomainv2.SecretSource{SecretName: "eks-sync-app"}), false),
+		Entry("from a source store in the region", secretManager("a", other, mydomainv2.SecretSource{SecretName: "eks-sync-app", StoreRef: prod}), true),
+		Entry("another secret", secretManager("a", prod, mydomainv2.SecretSource{SecretName: "eks-sync-other"}), false),
+		Entry("only generated values", secretManager("a", prod), false),
+	)
+
+	It("Should annotate only the SecretManagers reading the secret", func() {
+		scheme := runtime.NewScheme()
+		Expect(mydomainv2.AddToScheme(scheme)).To(Succeed())
+		client := dynamicfake.NewSimpleDynamicClient(scheme,
+			secretManager("app", prod, mydomainv2.SecretSource{SecretName: "eks-sync-app"}),
+			secretManager("other", prod, mydomainv2.SecretSource{SecretName: "eks-sync-other"}),
+		)
+
+		ctx := context.Background()
+		Expect(annotateSecretManagers(ctx, client, "ap-southeast-1", "eks-sync-app", "event")).To(Equal([]TargetResult{
+			{Namespace: "default", Name: "app", Outcome: OutcomeNudged},
+		}))
+
+		get := func(name string) *unstructured.Unstructured {
+			obj, err := client.Resource(secretManagerResource).Namespace("default").Get(ctx, name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			return obj
+		}
+		Expect(get("app").GetAnnotations()).To(HaveKeyWithValue(mydomainv2.ForceSyncAnnotation, "event"))
+		Expect(get("other").GetAnnotations()).NotTo(HaveKey(mydomainv2.ForceSyncAnnotation))
+
+		By("retrying the event")
+		Expect(annotateSecretManagers(ctx, client, "ap-southeast-1", "eks-sync-app", "event")).To(Equal([]TargetResult{
+			{Namespace: "default", Name: "app", Outcome: OutcomeUnchanged},
+		}))
+	})
+})
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+// FieldManager is the server-side apply field manager of the Lambda
+const FieldManager = "aws-secrets-sync-lambda"
+
+// OwnershipPolicy is what happens when a synced Secret already exists and is
+// managed by someone else, such as the SecretManager operator or a human
+type OwnershipPolicy string
+
+const (
+	// OwnershipPolicyRefuse leaves the Secret untouched and reports an error
+	OwnershipPolicyRefuse OwnershipPolicy = "refuse"
+	// OwnershipPolicyMerge writes the keys of the AWS secret into the Secret,
+	// leaving its other keys and its ownership alone
+	OwnershipPolicyMerge OwnershipPolicy = "merge"
+)
+
+// ErrNotOwned is returned when a Secret managed by someone else is refused
+var ErrNotOwned = errors.New("secret is not managed by the Lambda")
+
+// secretOwner describes who manages secret, or returns "" when the Lambda
+// does. Owner references win over the managed-by label.
+func secretOwner(secret *corev1.Secret) string {
+	if ref := metav1.GetControllerOf(secret); ref != nil {
+		return fmt.Sprintf("%s %s", ref.Kind, ref.Name)
+	}
+	if len(secret.OwnerReferences) > 0 {
+		return fmt.Sprintf("%s %s", secret.OwnerReferences[0].Kind, secret.OwnerReferences[0].Name)
+	}
+	switch value := secret.Labels[ManagedByLabel]; value {
+	case ManagedByValue:
+		return ""
+	case "":
+		return "another client"
+	default:
+		return value
+	}
+}
+
+// operatorOwned reports whether secret is controlled by a SecretManager,
+// which keeps it in sync on its own
+func operatorOwned(secret *corev1.Secret) bool {
+	ref := metav1.GetControllerOf(secret)
+	if ref == nil || ref.Kind != "SecretManager" {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	return err == nil && gv.Group == mydomainv2.GroupVersion.Group
+}
+
+// managedSecret returns the apply configuration of the Secret of target, fully
+// managed by the Lambda. Fields the Lambda applied before and leaves out, such
+// as labels dropped from a routing rule, are removed.
+func managedSecret(target SyncTarget, data map[string][]byte) *corev1ac.SecretApplyConfiguration {
+	secret := corev1ac.Secret(target.Name, target.Namespace).
+		WithLabels(target.Labels).
+		WithLabels(map[string]string{ManagedByLabel: ManagedByValue}).
+		WithData(data)
+	if target.Type != "" {
+		secret.WithType(target.Type)
+	}
+	return secret
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Secret ownership", func() {
+	var ctx context.Context
+	data := map[string][]byte{"password": []byte("s3cr3t")}
+	target := SyncTarget{Namespace: "default", Name: "app"}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	get := func(client *fake.Clientset) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets("default").Get(ctx, "app", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return secret
+	}
+
+	DescribeTable("secretOwner",
+		func(meta metav1.ObjectMeta, expected string) {
+			Expect(secretOwner(&corev1.Secret{ObjectMeta: meta})).To(Equal(expected))
+		},
+		Entry("the Lambda", metav1.ObjectMeta{Labels: map[string]string{ManagedByLabel: ManagedByValue}}, ""),
+		Entry("another manager", metav1.ObjectMeta{Labels: map[string]string{ManagedByLabel: "helm"}}, "helm"),
+		Entry("unlabelled", metav1.ObjectMeta{}, "another client"),
+		Entry("an owner reference", metav1.ObjectMeta{
+			Labels: map[string]string{ManagedByLabel: ManagedByValue},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ConfigMap", Name: "other"},
+				{Kind: "SecretManager", Name: "app", Controller: ptr.To(true)},
+			},
+		}, "SecretManager app"),
+	)
+
+	It("Should create missing Secrets labelled as managed by the Lambda", func() {
+		client := fake.NewClientset()
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "event/v1")).To(Equal(OutcomeCreated))
+
+		secret := get(client)
+		Expect(secret.Labels).To(HaveKeyWithValue(ManagedByLabel, ManagedByValue))
+		Expect(secret.Annotations).To(HaveKeyWithValue(SyncKeyAnnotation, "event/v1"))
+		Expect(secret.Data).To(Equal(data))
+	})
+
+	It("Should apply the labels and type of the target", func() {
+		client := fake.NewClientset()
+		tls := SyncTarget{Namespace: "default", Name: "app", Labels: map[string]string{"team": "a"}, Type: corev1.SecretTypeTLS}
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, tls, data, "event/v1")).To(Equal(OutcomeCreated))
+
+		secret := get(client)
+		Expect(secret.Labels).To(Equal(map[string]string{"team": "a", ManagedByLabel: ManagedByValue}))
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+	})
+
+	It("Should replace the data of its own Secrets and clear the orphaned annotation", func() {
+		client := fake.NewClientset()
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, map[string][]byte{"old": []byte("x")}, "put/v1")).To(Equal(OutcomeCreated))
+		Expect(deleteKubernetesSecret(ctx, client, DeletePolicyOrphan, target)).To(Equal(OutcomeOrphaned))
+		Expect(get(client).Annotations).To(HaveKey(OrphanedAnnotation))
+
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "restore/v2")).To(Equal(OutcomeUpdated))
+		secret := get(client)
+		Expect(secret.Data).To(Equal(data))
+		Expect(secret.Annotations).NotTo(HaveKey(OrphanedAnnotation))
+	})
+
+	It("Should refuse Secrets owned by the operator", func() {
+		client := fake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "app", Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "SecretManager", Name: "app", Controller: ptr.To(true)}},
+			},
+			Data: map[string][]byte{"password": []byte("operator")},
+		})
+		outcome, err := updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "event/v1")
+		Expect(outcome).To(Equal(OutcomeRefused))
+		Expect(err).To(MatchError(ErrNotOwned))
+		Expect(err).To(MatchError(ContainSubstring("SecretManager app")))
+		Expect(get(client).Data).To(HaveKeyWithValue("password", []byte("operator")))
+	})
+
+	It("Should merge keys into Secrets managed by someone else", func() {
+		client := fake.NewClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Data:       map[string][]byte{"username": []byte("admin")},
+		})
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyMerge, target, data, "event/v1")).To(Equal(OutcomeUpdated))
+
+		secret := get(client)
+		Expect(secret.Data).To(Equal(map[string][]byte{"username": []byte("admin"), "password": []byte("s3cr3t")}))
+		Expect(secret.Labels).NotTo(HaveKey(ManagedByLabel))
+	})
+
+	It("Should retry writes that conflict", func() {
+		client := fake.NewClientset()
+		conflicts := 2
+		client.PrependReactor("patch", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+			if conflicts == 0 {
+				return false, nil, nil
+			}
+			conflicts--
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, "app", nil)
+		})
+
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "event/v1")).To(Equal(OutcomeCreated))
+		Expect(conflicts).To(BeZero())
+		Expect(get(client).Data).To(Equal(data))
+	})
+
+	It("Should not write again when an event is retried", func() {
+		client := fake.NewClientset()
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "event/v1")).To(Equal(OutcomeCreated))
+		client.ClearActions()
+
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "event/v1")).To(Equal(OutcomeUnchanged))
+		for _, action := range client.Actions() {
+			Expect(action.GetVerb()).To(Equal("get"))
+		}
+
+		Expect(updateKubernetesSecret(ctx, client, OwnershipPolicyRefuse, target, data, "other-event/v1")).To(Equal(OutcomeUpdated))
+		Expect(get(client).Annotations).To(HaveKeyWithValue(SyncKeyAnnotation, "other-event/v1"))
+	})
+})
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Outcome is what happened to one target of an event
+type Outcome string
+
+const (
+	OutcomeCreated Outcome = "created"
+	OutcomeUpdated Outcome = "updated"
+	// OutcomeUnchanged is a target a retry of the event had already written
+	OutcomeUnchanged Outcome = "unchanged"
+	// OutcomeSkipped is a target left alone, missing or managed by someone else
+	OutcomeSkipped  Outcome = "skipped"
+	OutcomeDeleted  Outcome = "deleted"
+	OutcomeOrphaned Outcome = "orphaned"
+	OutcomeNudged   Outcome = "nudged"
+	// OutcomeOrphan is a managed Secret no AWS secret is written to, found
+	// by a resync and left alone
+	OutcomeOrphan Outcome = "orphan"
+	// OutcomeRefused is a Secret managed by someone else that the ownership
+	// policy does not allow writing to
+	OutcomeRefused Outcome = "refused"
+	OutcomeFailed  Outcome = "failed"
+)
+
+// TargetResult is the outcome for one Secret, or one SecretManager in nudge
+// mode
+type TargetResult struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Outcome   Outcome `json:"outcome"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// newTargetResult returns the result of writing to a target
+func newTargetResult(namespace, name string, outcome Outcome, err error) TargetResult {
+	result := TargetResult{Namespace: namespace, Name: name, Outcome: outcome}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// ClusterResult is the outcome of an event in one EKS cluster
+type ClusterResult struct {
+	Cluster string         `json:"cluster"`
+	Targets []TargetResult `json:"targets,omitempty"`
+	// Error is set when the targets of the cluster could not be reached
+	Error string `json:"error,omitempty"`
+}
+
+// Failed reports whether the cluster or one of its targets failed
+func (r ClusterResult) Failed() bool {
+	if r.Error != "" {
+		return true
+	}
+	for _, target := range r.Targets {
+		if target.Outcome == OutcomeFailed || target.Outcome == OutcomeRefused {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is returned by the handler, for EventBridge and Lambda destinations
+type Result struct {
+	EventID   string          `json:"eventId"`
+	EventName string          `json:"eventName"`
+	SecretID  string          `json:"secretId"`
+	VersionID string          `json:"versionId,omitempty"`
+	Clusters  []ClusterResult `json:"clusters"`
+	// Errors are failures outside any cluster, such as secrets a resync
+	// could not route
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Failed reports whether the event failed in any cluster, or outside them
+func (r Result) Failed() bool {
+	if len(r.Errors) > 0 {
+		return true
+	}
+	for _, cluster := range r.Clusters {
+		if cluster.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultError is returned when an event failed in some cluster. DLQs and
+// on-failure destinations only receive the error message, so the message is
+// the JSON result with every outcome.
+type ResultError struct {
+	Result Result
+}
+
+func (e *ResultError) Error() string {
+	message, err := json.Marshal(e.Result)
+	if err != nil {
+		return errors.Join(errors.New("event failed"), err).Error()
+	}
+	return string(message)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/huonguyenlt/secret-manager/pkg/secretdata"
+)
+
+const (
+	// ScheduledEventType is the detail type of events from EventBridge
+	// schedule rules, which trigger a resync
+	ScheduledEventType = "Scheduled Event"
+	// EventResync is the event name of resync results
+	EventResync = "Resync"
+	// currentStage is the staging label of the current version of a secret
+	currentStage = "AWSCURRENT"
+)
+
+// routedSecret is an AWS secret found by a resync, and where it is synced to
+type routedSecret struct {
+	ID        string
+	Name      string
+	VersionID string
+	Clusters  []string
+	Targets   []SyncTarget
+}
+
+// secretValue is the decoded value of an AWS secret and its version ID
+type secretValue struct {
+	data      map[string][]byte
+	versionID string
+}
+
+// HandleResync handles scheduled events. It repairs the Secrets
+// events failed to write: it lists every routed AWS secret, and writes the
+// ones whose Secrets are missing or hold another version. Managed Secrets
+// without an AWS secret are reported as orphans and left alone, and so are
+// Secrets of SecretManagers unless the ownership policy merges into them.
+func (h *Handler) HandleResync(ctx context.Context, event events.CloudWatchEvent) (Result, error) {
+	log := eventLogger(ctx, event.ID).With("eventName", EventResync)
+	ctx = withLogger(ctx, log)
+	result := Result{EventID: event.ID, EventName: EventResync}
+
+	// The operator reconciles its SecretManagers periodically on its own
+	if h.cfg.SyncMode == SyncModeNudge {
+		log.Info("Resync is not needed in nudge mode, skipping")
+		return result, nil
+	}
+
+	secrets, err := h.listRoutedSecrets(ctx, &result)
+	if err != nil {
+		log.Error("Resync failed", "error", err)
+		return result, err
+	}
+	log.Info("Listed routed secrets", "secrets", len(secrets))
+
+	// Every secret value is fetched at most once, and only when some Secret
+	// needs it
+	fetchers := make(map[string]func() (secretValue, error), len(secrets))
+	for _, secret := range secrets {
+		fetchers[secret.ID] = sync.OnceValues(func() (secretValue, error) {
+			data, versionID, err := getSecretFromAWS(ctx, h.secrets, secret.ID, secretdata.Options{Separator: h.cfg.FlattenSeparator})
+			return secretValue{data: data, versionID: versionID}, err
+		})
+	}
+	fetch := func(_ context.Context, secret routedSecret) (secretValue, error) {
+		return fetchers[secret.ID]()
+	}
+
+	// Clusters only named in tags are visited too, for their orphans, or to
+	// report them when they are not configured
+	clusters := slices.Clone(h.cfg.EKSClusterNames)
+	for _, secret := range secrets {
+		clusters = append(clusters, secret.Clusters...)
+	}
+	result.Clusters = h.forEachCluster(ctx, dedupe(clusters), func(ctx context.Context, cluster string) ([]TargetResult, error) {
+		k8sClient, err := h.clusters.Kubernetes(ctx, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+		}
+		var routed []routedSecret
+		namespaces := []string{h.cfg.Namespace}
+		for _, secret := range secrets {
+			if slices.Contains(secret.Clusters, cluster) {
+				routed = append(routed, secret)
+				for _, target := range secret.Targets {
+					namespaces = append(namespaces, target.Namespace)
+				}
+			}
+		}
+		return resyncCluster(ctx, k8sClient, h.cfg.OwnershipPolicy, dedupe(namespaces), routed, event.ID, fetch)
+	})
+
+	logResults(ctx, result.Clusters)
+	if result.Failed() {
+		return result, &ResultError{Result: result}
+	}
+	return result, nil
+}
+
+// listRoutedSecrets lists the AWS secrets matching a routing rule. Secrets
+// that match but can not be routed are recorded in result.
+func (h *Handler) listRoutedSecrets(ctx context.Context, result *Result) ([]routedSecret, error) {
+	var secrets []routedSecret
+	paginator := secretsmanager.NewListSecretsPaginator(h.secrets, &secretsmanager.ListSecretsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		for _, entry := range page.SecretList {
+			secret, ok, err := routeListedSecret(h.cfg, entry)
+			if err != nil {
+				logFrom(ctx).Error("Failed to route secret", "secretId", aws.ToString(entry.ARN), "error", err)
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", aws.ToString(entry.Name), err))
+				continue
+			}
+			if ok {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// routeListedSecret resolves the clusters and Secrets of a listed AWS secret.
+// It returns false when no routing rule matches the secret.
+func routeListedSecret(cfg Config, entry smtypes.SecretListEntry) (routedSecret, bool, error) {
+	name := aws.ToString(entry.Name)
+	if !cfg.Routing.mayMatch(name) {
+		return routedSecret{}, false, nil
+	}
+
+	tags := make(map[string]string, len(entry.Tags))
+	for _, tag := range entry.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+	targets, err := resolveTargets(cfg, name, tags)
+	if err != nil {
+		return routedSecret{}, false, fmt.Errorf("failed to resolve targets: %w", err)
+	}
+	if len(targets) == 0 {
+		return routedSecret{}, false, nil
+	}
+
+	secret := routedSecret{
+		ID:       aws.ToString(entry.ARN),
+		Name:     name,
+		Clusters: resolveClusters(cfg, tags),
+		Targets:  targets,
+	}
+	for versionID, stages := range entry.SecretVersionsToStages {
+		if slices.Contains(stages, currentStage) {
+			secret.VersionID = versionID
+		}
+	}
+	return secret, true, nil
+}
+
+// resyncCluster writes the routed secrets whose Secrets in the cluster are
+// missing or hold another version, and reports managed Secrets in namespaces
+// no routed secret is written to as orphans. Namespaces are listed one by
+// one, as the Lambda may only have access to those it writes to. fetch
+// returns the value of a secret.
+func resyncCluster(ctx context.Context, client kubernetes.Interface, policy OwnershipPolicy, namespaces []string, secrets []routedSecret, eventID string, fetch func(ctx context.Context, secret routedSecret) (secretValue, error)) ([]TargetResult, error) {
+	var listed []corev1.Secret
+	for _, namespace := range namespaces {
+		list, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: ManagedByLabel + "=" + ManagedByValue,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list managed secrets in namespace %s: %w", namespace, err)
+		}
+		listed = append(listed, list.Items...)
+	}
+	managed := make(map[types.NamespacedName]*corev1.Secret, len(listed))
+	for i := range listed {
+		secret := &listed[i]
+		managed[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] = secret
+	}
+
+	var results []TargetResult
+	routed := map[types.NamespacedName]bool{}
+	for _, secret := range secrets {
+		for _, target := range secret.Targets {
+			key := types.NamespacedName{Namespace: target.Namespace, Name: target.Name}
+			routed[key] = true
+
+			// Secrets merged into are not labelled, so are not listed
+			existing, ok := managed[key]
+			if !ok {
+				got, err := client.CoreV1().Secrets(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+				switch {
+				case err == nil:
+					existing = got
+				case !apierrors.IsNotFound(err):
+					results = append(results, newTargetResult(target.Namespace, target.Name, OutcomeFailed, err))
+					continue
+				}
+			}
+			// The operator keeps its Secrets in sync: refusing them would fail
+			// every resync
+			if existing != nil && policy != OwnershipPolicyMerge && operatorOwned(existing) {
+				results = append(results, newTargetResult(target.Namespace, target.Name, OutcomeSkipped, nil))
+				continue
+			}
+			if existing != nil && secret.VersionID != "" && syncedVersion(existing) == secret.VersionID {
+				results = append(results, newTargetResult(target.Namespace, target.Name, OutcomeUnchanged, nil))
+				continue
+			}
+
+			value, err := fetch(ctx, secret)
+			if err != nil {
+				results = append(results, newTargetResult(target.Namespace, target.Name, OutcomeFailed, err))
+				continue
+			}
+			outcome, err := updateKubernetesSecret(ctx, client, policy, target, value.data, eventID+"/"+value.versionID)
+			results = append(results, newTargetResult(target.Namespace, target.Name, outcome, err))
+		}
+	}
+
+	for _, secret := range listed {
+		if !routed[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] {
+			results = append(results, newTargetResult(secret.Namespace, secret.Name, OutcomeOrphan, nil))
+		}
+	}
+	return results, nil
+}
+
+// syncedVersion returns the secret version ID last written to secret, from
+// its SyncKeyAnnotation
+func syncedVersion(secret *corev1.Secret) string {
+	syncKey, ok := secret.Annotations[SyncKeyAnnotation]
+	if !ok {
+		return ""
+	}
+	return syncKey[strings.LastIndex(syncKey, "/")+1:]
+}
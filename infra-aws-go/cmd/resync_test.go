@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Resync", func() {
+	Context("routeListedSecret", func() {
+		var cfg Config
+
+		BeforeEach(func() {
+			cfg = Config{EKSClusterNames: []string{"prod"}, Namespace: "default", Routing: defaultRouting("eks-sync-", "default")}
+			Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+		})
+
+		It("Should route secrets with their current version", func() {
+			secret, ok, err := routeListedSecret(cfg, smtypes.SecretListEntry{
+				ARN:  aws.String("arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-app-AbCdEf"),
+				Name: aws.String("eks-sync-app"),
+				Tags: []smtypes.Tag{{Key: aws.String(ClustersTag), Value: aws.String("dev")}},
+				SecretVersionsToStages: map[string][]string{
+					"v1": {"AWSPREVIOUS"},
+					"v2": {"AWSCURRENT"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(secret).To(Equal(routedSecret{
+				ID:        "arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-app-AbCdEf",
+				Name:      "eks-sync-app",
+				VersionID: "v2",
+				Clusters:  []string{"dev"},
+				Targets:   []SyncTarget{{Namespace: "default", Name: "eks-sync-app", Type: corev1.SecretTypeOpaque}},
+			}))
+		})
+
+		It("Should skip secrets no rule matches", func() {
+			_, ok, err := routeListedSecret(cfg, smtypes.SecretListEntry{Name: aws.String("other-app")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("resyncCluster", func() {
+		var (
+			ctx     context.Context
+			fetched int
+			value   = secretValue{data: map[string][]byte{"password": []byte("s3cr3t")}, versionID: "v2"}
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			fetched = 0
+		})
+
+		fetch := func(context.Context, routedSecret) (secretValue, error) {
+			fetched++
+			return value, nil
+		}
+
+		routed := func(name string) routedSecret {
+			return routedSecret{ID: name, Name: name, VersionID: "v2", Targets: []SyncTarget{{Namespace: "default", Name: name}}}
+		}
+
+		secret := func(name, syncKey string, labels map[string]string) *corev1.Secret {
+			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "default", Labels: labels,
+				Annotations: map[string]string{SyncKeyAnnotation: syncKey},
+			}}
+		}
+		managed := map[string]string{ManagedByLabel: ManagedByValue}
+
+		It("Should repair missing and stale Secrets, and report orphans", func() {
+			client := fake.NewClientset(
+				secret("current", "event/v2", managed),
+				secret("stale", "event/v1", managed),
+				secret("orphan", "event/v1", managed),
+				secret("unrelated", "", nil),
+			)
+			results, err := resyncCluster(ctx, client, OwnershipPolicyRefuse, []string{"default"},
+				[]routedSecret{routed("current"), routed("stale"), routed("missing")}, "resync", fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(ConsistOf(
+				TargetResult{Namespace: "default", Name: "current", Outcome: OutcomeUnchanged},
+				TargetResult{Namespace: "default", Name: "stale", Outcome: OutcomeUpdated},
+				TargetResult{Namespace: "default", Name: "missing", Outcome: OutcomeCreated},
+				TargetResult{Namespace: "default", Name: "orphan", Outcome: OutcomeOrphan},
+			))
+			Expect(fetched).To(Equal(2))
+
+			repaired, err := client.CoreV1().Secrets("default").Get(ctx, "missing", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(repaired.Data).To(Equal(value.data))
+			Expect(repaired.Annotations).To(HaveKeyWithValue(SyncKeyAnnotation, "resync/v2"))
+		})
+
+		It("Should leave merged Secrets holding the current version alone", func() {
+			client := fake.NewClientset(secret("merged", "event/v2", nil))
+			results, err := resyncCluster(ctx, client, OwnershipPolicyMerge, []string{"default"}, []routedSecret{routed("merged")}, "resync", fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]TargetResult{{Namespace: "default", Name: "merged", Outcome: OutcomeUnchanged}}))
+			Expect(fetched).To(BeZero())
+		})
+
+		It("Should skip Secrets of SecretManagers without refusing them", func() {
+			owned := secret("operator", "", nil)
+			owned.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "my.domain/v2", Kind: "SecretManager", Name: "app", UID: "sm-uid", Controller: aws.Bool(true),
+			}}
+			other := secret("other", "", nil)
+			other.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "deploy-uid", Controller: aws.Bool(true),
+			}}
+			client := fake.NewClientset(owned, other, secret("current", "event/v2", managed))
+			results, err := resyncCluster(ctx, client, OwnershipPolicyRefuse, []string{"default"},
+				[]routedSecret{routed("operator"), routed("current")}, "resync", fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(ConsistOf(
+				TargetResult{Namespace: "default", Name: "operator", Outcome: OutcomeSkipped},
+				TargetResult{Namespace: "default", Name: "current", Outcome: OutcomeUnchanged},
+			))
+			Expect(fetched).To(BeZero())
+
+			results, err = resyncCluster(ctx, client, OwnershipPolicyRefuse, []string{"default"}, []routedSecret{routed("other")}, "resync", fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(ContainElement(And(HaveField("Name", "other"), HaveField("Outcome", OutcomeRefused))))
+		})
+
+		It("Should report secrets whose value can not be fetched", func() {
+			failing := func(context.Context, routedSecret) (secretValue, error) {
+				return secretValue{}, errors.New("access denied")
+			}
+			results, err := resyncCluster(ctx, fake.NewClientset(), OwnershipPolicyRefuse, []string{"default"}, []routedSecret{routed("app")}, "resync", failing)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]TargetResult{{Namespace: "default", Name: "app", Outcome: OutcomeFailed, Error: "access denied"}}))
+		})
+	})
+})
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Routing decides which AWS secrets are synced and where to. Rules are tried
+// in order and the first match wins; secrets matching no rule are not synced.
+type Routing struct {
+	Rules []RoutingRule `json:"rules"`
+}
+
+// RoutingRule matches AWS secrets and describes the Secrets they are written
+// to. Namespaces and NameTemplate are Go templates executed with
+// TemplateData.
+type RoutingRule struct {
+	Match RuleMatch `json:"match"`
+	// Namespaces default to K8S_NAMESPACE
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NameTemplate defaults to the sanitized name of the secret
+	NameTemplate string            `json:"nameTemplate,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	// Type defaults to Opaque. The type of an existing Secret can not change.
+	Type corev1.SecretType `json:"type,omitempty"`
+
+	namespaces []*template.Template
+	name       *template.Template
+}
+
+// RuleMatch matches the name of an AWS secret, its tags, or both. A secret
+// missing a tag does not match.
+type RuleMatch struct {
+	Name *Pattern           `json:"name,omitempty"`
+	Tags map[string]Pattern `json:"tags,omitempty"`
+}
+
+// Pattern matches a whole string with either a glob, where "*" matches any
+// characters including "/" and "?" matches one, or a regular expression.
+type Pattern struct {
+	Glob  string `json:"glob,omitempty"`
+	Regex string `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// TemplateData is what the templates of a rule are executed with
+type TemplateData struct {
+	// Name is the name of the AWS secret
+	Name string
+	// Tags are the tags of the AWS secret
+	Tags map[string]string
+	// Groups are the named groups of the name regex of the rule
+	Groups map[string]string
+}
+
+// templateFuncs are the functions available to templates. Their subject comes
+// last so they read well in pipelines, e.g. {{ .Name | trimPrefix "a-" }}.
+var templateFuncs = template.FuncMap{
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"dns1123":    sanitizeName,
+}
+
+// defaultRouting returns the routing used without a routing file: secrets
+// whose name starts with prefix go to namespace
+func defaultRouting(prefix, namespace string) Routing {
+	return Routing{Rules: []RoutingRule{{
+		Match:      RuleMatch{Name: &Pattern{Regex: "^" + regexp.QuoteMeta(prefix)}},
+		Namespaces: []string{namespace},
+	}}}
+}
+
+// compile validates the rules and prepares their patterns and templates.
+// Rules without namespaces get defaultNamespace.
+func (r *Routing) compile(defaultNamespace string) error {
+	var errs []error
+	for i := range r.Rules {
+		if err := r.Rules[i].compile(defaultNamespace); err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RoutingRule) compile(defaultNamespace string) error {
+	var errs []error
+	if r.Match.Name == nil && len(r.Match.Tags) == 0 {
+		errs = append(errs, errors.New("match needs a name or tags"))
+	}
+	if r.Match.Name != nil {
+		if err := r.Match.Name.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("match.name: %w", err))
+		}
+	}
+	for key, pattern := range r.Match.Tags {
+		if err := pattern.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("match.tags[%s]: %w", key, err))
+		}
+		r.Match.Tags[key] = pattern
+	}
+
+	if len(r.Namespaces) == 0 {
+		r.Namespaces = []string{defaultNamespace}
+	}
+	r.namespaces = nil
+	for _, namespace := range r.Namespaces {
+		// Namespaces without actions are checked now rather than per event
+		if !strings.Contains(namespace, "{{") {
+			if problems := validation.IsDNS1123Label(namespace); len(problems) > 0 {
+				errs = append(errs, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(problems, ", ")))
+				continue
+			}
+		}
+		tmpl, err := template.New("namespace").Funcs(templateFuncs).Option("missingkey=error").Parse(namespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("namespaces: %w", err))
+			continue
+		}
+		r.namespaces = append(r.namespaces, tmpl)
+	}
+	nameTemplate := r.NameTemplate
+	if nameTemplate == "" {
+		nameTemplate = "{{ .Name | dns1123 }}"
+	}
+	tmpl, err := template.New("name").Funcs(templateFuncs).Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("nameTemplate: %w", err))
+	}
+	r.name = tmpl
+
+	for key, value := range r.Labels {
+		if key == ManagedByLabel {
+			errs = append(errs, fmt.Errorf("labels: %s is set by the Lambda", ManagedByLabel))
+		}
+		if problems := validation.IsQualifiedName(key); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("labels: invalid key %q: %s", key, strings.Join(problems, ", ")))
+		}
+		if problems := validation.IsValidLabelValue(value); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("labels: invalid value %q: %s", value, strings.Join(problems, ", ")))
+		}
+	}
+	if r.Type == "" {
+		r.Type = corev1.SecretTypeOpaque
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pattern) compile() error {
+	if (p.Glob == "") == (p.Regex == "") {
+		return errors.New("exactly one of glob and regex is required")
+	}
+	expr := p.Regex
+	if p.Glob != "" {
+		var b strings.Builder
+		b.WriteString("^")
+		for _, r := range p.Glob {
+			switch r {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteString(".")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		b.WriteString("$")
+		expr = b.String()
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	p.re = re
+	return nil
+}
+
+// mayMatch reports whether some rule could match a secret named secretName,
+// before its tags are known
+func (r Routing) mayMatch(secretName string) bool {
+	for _, rule := range r.Rules {
+		if rule.Match.Name == nil || rule.Match.Name.re.MatchString(secretName) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the first rule matching the secret, and the data for its
+// templates
+func (r Routing) match(secretName string, tags map[string]string) (*RoutingRule, TemplateData, bool) {
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		data := TemplateData{Name: secretName, Tags: tags, Groups: map[string]string{}}
+		if data.Tags == nil {
+			data.Tags = map[string]string{}
+		}
+
+		if rule.Match.Name != nil {
+			groups := rule.Match.Name.re.FindStringSubmatch(secretName)
+			if groups == nil {
+				continue
+			}
+			for j, name := range rule.Match.Name.re.SubexpNames() {
+				if name != "" {
+					data.Groups[name] = groups[j]
+				}
+			}
+		}
+		matched := true
+		for key, pattern := range rule.Match.Tags {
+			value, ok := tags[key]
+			if !ok || !pattern.re.MatchString(value) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule, data, true
+		}
+	}
+	return nil, TemplateData{}, false
+}
+
+// targets returns the Secrets the rule writes a secret to
+func (r *RoutingRule) targets(data TemplateData) ([]SyncTarget, error) {
+	name, err := execute(r.name, data)
+	if err != nil {
+		return nil, fmt.Errorf("nameTemplate: %w", err)
+	}
+
+	var targets []SyncTarget
+	for _, tmpl := range r.namespaces {
+		namespace, err := execute(tmpl, data)
+		if err != nil {
+			return nil, fmt.Errorf("namespaces: %w", err)
+		}
+		targets = append(targets, SyncTarget{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    maps.Clone(r.Labels),
+			Type:      r.Type,
+		})
+	}
+	return targets, nil
+}
+
+func execute(tmpl *template.Template, data TemplateData) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
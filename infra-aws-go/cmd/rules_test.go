@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const sampleRouting = `
+rules:
+- match:
+    name: {regex: '^eks-sync-(?P<team>[a-z]+)/prod/'}
+  namespaces: ['{{ .Groups.team }}']
+  nameTemplate: '{{ .Name | trimPrefix "eks-sync-" | dns1123 }}'
+  labels: {env: prod}
+- match:
+    name: {glob: 'eks-sync-*/tls/*'}
+    tags:
+      k8s/type: {glob: tls}
+  namespaces: [ingress]
+  type: kubernetes.io/tls
+- match:
+    tags:
+      team: {regex: '^(payments|billing)$'}
+  namespaces: ['{{ .Tags.team }}', shared]
+  nameTemplate: '{{ .Name | replace "/" "-" | lower }}'
+- match:
+    name: {glob: 'eks-sync-*'}
+`
+
+var _ = Describe("Routing rules", func() {
+	var cfg Config
+
+	BeforeEach(func() {
+		cfg = Config{Namespace: "default", AllowedNamespaces: []string{"payments-v2"}}
+		Expect(yaml.UnmarshalStrict([]byte(sampleRouting), &cfg.Routing)).To(Succeed())
+		Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+	})
+
+	// route resolves the targets of a CloudWatch event the way HandleRequest
+	// does, with tags standing in for DescribeSecret
+	route := func(event string, tags map[string]string) ([]SyncTarget, error) {
+		var cwEvent events.CloudWatchEvent
+		Expect(json.Unmarshal([]byte(event), &cwEvent)).To(Succeed())
+		var detail SecretsManagerEventDetail
+		Expect(json.Unmarshal(cwEvent.Detail, &detail)).To(Succeed())
+
+		secretName := secretNameFromID(detail.SecretID())
+		if !cfg.Routing.mayMatch(secretName) {
+			return nil, nil
+		}
+		return resolveTargets(cfg, secretName, tags)
+	}
+
+	DescribeTable("CloudWatch events",
+		func(event string, tags map[string]string, expected []SyncTarget) {
+			Expect(route(event, tags)).To(Equal(expected))
+		},
+		Entry("name regex with a named group",
+			`{"id":"1","detail":{"eventName":"PutSecretValue","requestParameters":{"secretId":"arn:aws:secretsmanager:ap-southeast-1:111111111111:secret:eks-sync-payments/prod/db-AbCdEf"}}}`,
+			nil,
+			[]SyncTarget{{Namespace: "payments", Name: "payments-prod-db", Labels: map[string]string{"env": "prod"}, Type: corev1.SecretTypeOpaque}},
+		),
+		Entry("name glob and tag",
+			`{"id":"2","detail":{"eventName":"RotationSucceeded","additionalEventData":{"SecretId":"eks-sync-edge/tls/cert"}}}`,
+			map[string]string{"k8s/type": "tls"},
+			[]SyncTarget{{Namespace: "ingress", Name: "eks-sync-edge-tls-cert", Type: corev1.SecretTypeTLS}},
+		),
+		Entry("falls through to the next rule when a tag is missing",
+			`{"id":"3","detail":{"eventName":"UpdateSecret","requestParameters":{"secretId":"eks-sync-edge/tls/cert"}}}`,
+			nil,
+			[]SyncTarget{{Namespace: "default", Name: "eks-sync-edge-tls-cert", Type: corev1.SecretTypeOpaque}},
+		),
+		Entry("tags only, fanning out to several namespaces",
+			`{"id":"4","detail":{"eventName":"TagResource","requestParameters":{"secretId":"Billing/Invoices"}}}`,
+			map[string]string{"team": "billing"},
+			[]SyncTarget{
+				{Namespace: "billing", Name: "billing-invoices", Type: corev1.SecretTypeOpaque},
+				{Namespace: "shared", Name: "billing-invoices", Type: corev1.SecretTypeOpaque},
+			},
+		),
+		Entry("tags overriding the rule",
+			`{"id":"5","detail":{"eventName":"PutSecretValue","requestParameters":{"secretId":"eks-sync-payments/prod/db"}}}`,
+			map[string]string{NamespaceTag: "payments-v2", SecretNameTag: "db"},
+			[]SyncTarget{{Namespace: "payments-v2", Name: "db", Labels: map[string]string{"env": "prod"}, Type: corev1.SecretTypeOpaque}},
+		),
+		Entry("no matching rule",
+			`{"id":"6","detail":{"eventName":"PutSecretValue","requestParameters":{"secretId":"other/app"}}}`,
+			map[string]string{"team": "marketing"},
+			nil,
+		),
+	)
+
+	It("Should skip secrets before describing them when no rule can match their name", func() {
+		cfg.Routing = defaultRouting("eks-sync-", "default")
+		Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+		Expect(cfg.Routing.mayMatch("eks-sync-team/app")).To(BeTrue())
+		Expect(cfg.Routing.mayMatch("other/app")).To(BeFalse())
+	})
+
+	It("Should reject templates producing invalid names", func() {
+		cfg.Routing = Routing{Rules: []RoutingRule{{
+			Match:        RuleMatch{Name: &Pattern{Glob: "*"}},
+			NameTemplate: "{{ .Name }}",
+		}}}
+		Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+		_, err := resolveTargets(cfg, "Team/App", nil)
+		Expect(err).To(MatchError(ContainSubstring("invalid Secret name 'Team/App'")))
+	})
+
+	It("Should reject templates using missing tags", func() {
+		cfg.Routing = Routing{Rules: []RoutingRule{{
+			Match:      RuleMatch{Name: &Pattern{Glob: "*"}},
+			Namespaces: []string{"{{ .Tags.team }}"},
+		}}}
+		Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+		_, err := resolveTargets(cfg, "app", nil)
+		Expect(err).To(MatchError(ContainSubstring("namespaces:")))
+	})
+})
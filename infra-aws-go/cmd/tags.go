@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Tags on AWS secrets that route them into the cluster. Tag values can not
+// hold commas, so lists are separated by spaces.
+const (
+	// NamespaceTag lists the namespaces the secret is written to. Defaults to
+	// the namespaces of the matching routing rule. Other namespaces must be
+	// in ALLOWED_NAMESPACES.
+	NamespaceTag = "k8s/namespace"
+	// SecretNameTag is the name of the Kubernetes Secret. Defaults to the name
+	// template of the matching routing rule.
+	SecretNameTag = "k8s/secret-name"
+	// ClustersTag lists the EKS clusters the secret is synced to. Defaults to
+	// EKS_CLUSTER_NAMES.
+	ClustersTag = "k8s/clusters"
+)
+
+// SyncTarget is a Kubernetes Secret an AWS secret is written to
+type SyncTarget struct {
+	Namespace string
+	Name      string
+	Labels    map[string]string // Set besides the managed-by label
+	Type      corev1.SecretType
+}
+
+// describeSecret returns the name and tags of an AWS secret
+func describeSecret(ctx context.Context, svc SecretsManagerAPI, secretID string) (string, map[string]string, error) {
+	logFrom(ctx).Info("Describing secret")
+
+	result, err := svc.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: &secretID,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to describe secret: %w", err)
+	}
+
+	tags := make(map[string]string, len(result.Tags))
+	for _, tag := range result.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+
+	name := secretID
+	if result.Name != nil {
+		name = *result.Name
+	}
+	return name, tags, nil
+}
+
+// resolveTargets returns the Secrets the AWS secret secretName is written to
+// in every cluster, according to the first matching routing rule and its tags.
+// It returns no targets when no rule matches.
+func resolveTargets(cfg Config, secretName string, tags map[string]string) ([]SyncTarget, error) {
+	rule, data, ok := cfg.Routing.match(secretName, tags)
+	if !ok {
+		return nil, nil
+	}
+	routed, err := rule.targets(data)
+	if err != nil {
+		return nil, fmt.Errorf("routing rule for secret '%s': %w", secretName, err)
+	}
+
+	name := routed[0].Name
+	if tagged, ok := tags[SecretNameTag]; ok {
+		name = sanitizeName(tagged)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("secret '%s' has no usable Kubernetes name", secretName)
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid Secret name '%s' for secret '%s': %s", name, secretName, strings.Join(errs, ", "))
+	}
+
+	namespaces := make([]string, 0, len(routed))
+	for _, target := range routed {
+		namespaces = append(namespaces, target.Namespace)
+	}
+	// Tags may only name the namespaces of the rule and the allowed ones
+	var allowed []string
+	if tagged, ok := tags[NamespaceTag]; ok {
+		allowed = append(slices.Clone(cfg.AllowedNamespaces), namespaces...)
+		namespaces = strings.Fields(tagged)
+		if len(namespaces) == 0 {
+			return nil, fmt.Errorf("tag %s of secret '%s' is empty", NamespaceTag, secretName)
+		}
+	}
+
+	var targets []SyncTarget
+	for _, namespace := range dedupe(namespaces) {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace '%s' for secret '%s': %s", namespace, secretName, strings.Join(errs, ", "))
+		}
+		if allowed != nil && !slices.Contains(allowed, namespace) {
+			return nil, fmt.Errorf("namespace '%s' of secret '%s' is not in ALLOWED_NAMESPACES", namespace, secretName)
+		}
+		targets = append(targets, SyncTarget{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    routed[0].Labels,
+			Type:      routed[0].Type,
+		})
+	}
+	return targets, nil
+}
+
+// sanitizeName turns an AWS secret name such as "team/env/app" into a valid
+// Kubernetes Secret name such as "team-env-app". Letters are lower-cased and
+// every run of other characters becomes a single "-".
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else if b.Len() > 0 && !strings.HasSuffix(b.String(), "-") {
+			b.WriteByte('-')
+		}
+	}
+	sanitized := b.String()
+	if len(sanitized) > validation.DNS1123SubdomainMaxLength {
+		sanitized = sanitized[:validation.DNS1123SubdomainMaxLength]
+	}
+	return strings.TrimRight(sanitized, "-")
+}
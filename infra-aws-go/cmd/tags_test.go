@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Tag routing", func() {
+	var cfg Config
+
+	BeforeEach(func() {
+		cfg = Config{
+			EKSClusterNames:   []string{"prod"},
+			Namespace:         "default",
+			Routing:           defaultRouting("", "default"),
+			AllowedNamespaces: []string{"team-a", "team-b"},
+		}
+		Expect(cfg.Routing.compile(cfg.Namespace)).To(Succeed())
+	})
+
+	DescribeTable("sanitizeName",
+		func(name, expected string) {
+			Expect(sanitizeName(name)).To(Equal(expected))
+		},
+		Entry("keeps valid names", "eks-sync-app", "eks-sync-app"),
+		Entry("replaces slashes", "team/env/app", "team-env-app"),
+		Entry("lower-cases and collapses other characters", "Team__Env//App.Config", "team-env-app-config"),
+		Entry("trims leading and trailing separators", "/team/app/", "team-app"),
+		Entry("truncates long names", strings.Repeat("a", 300), strings.Repeat("a", 253)),
+		Entry("returns nothing for names without letters or digits", "//", ""),
+	)
+
+	It("Should write to the default namespace under the sanitized name", func() {
+		targets, err := resolveTargets(cfg, "team/prod/app", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(Equal([]SyncTarget{{Namespace: "default", Name: "team-prod-app", Type: corev1.SecretTypeOpaque}}))
+	})
+
+	It("Should fan out to every tagged namespace", func() {
+		targets, err := resolveTargets(cfg, "team/prod/app", map[string]string{
+			NamespaceTag:  "team-a  team-b team-a",
+			SecretNameTag: "App_Credentials",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(Equal([]SyncTarget{
+			{Namespace: "team-a", Name: "app-credentials", Type: corev1.SecretTypeOpaque},
+			{Namespace: "team-b", Name: "app-credentials", Type: corev1.SecretTypeOpaque},
+		}))
+	})
+
+	It("Should reject invalid namespaces", func() {
+		_, err := resolveTargets(cfg, "team/prod/app", map[string]string{NamespaceTag: "Team_A"})
+		Expect(err).To(MatchError(ContainSubstring("invalid namespace 'Team_A'")))
+	})
+
+	It("Should only fan out to the namespaces of the rule and the allowed ones", func() {
+		targets, err := resolveTargets(cfg, "team/prod/app", map[string]string{NamespaceTag: "default team-b"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(HaveLen(2))
+
+		_, err = resolveTargets(cfg, "team/prod/app", map[string]string{NamespaceTag: "team-a kube-system"})
+		Expect(err).To(MatchError("namespace 'kube-system' of secret 'team/prod/app' is not in ALLOWED_NAMESPACES"))
+	})
+
+	It("Should reject names without letters or digits", func() {
+		_, err := resolveTargets(cfg, "team/prod/app", map[string]string{SecretNameTag: "--"})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/eks"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// childOptions are the options of the resources of a component. The alias
+// keeps the resources created before the components existed.
+func childOptions(parent pulumi.Resource, opts ...pulumi.ResourceOption) []pulumi.ResourceOption {
+	return append([]pulumi.ResourceOption{
+		pulumi.Parent(parent),
+		pulumi.Aliases([]pulumi.Alias{{NoParent: pulumi.Bool(true)}}),
+	}, opts...)
+}
+
+// ClusterComponentArgs configures the EKS cluster
+type ClusterComponentArgs struct {
+	Name     string
+	Version  string
+	RoleName string
+	Region   string
+	// SubnetIds are the subnets of the control plane network interfaces
+	SubnetIds pulumi.StringArrayInput
+	// EncryptionKeyArn is the KMS key encrypting the Kubernetes secrets,
+	// when set
+	EncryptionKeyArn pulumi.StringInput
+}
+
+// ClusterComponent is the EKS cluster and its IAM role
+type ClusterComponent struct {
+	pulumi.ResourceState
+
+	// Name is the name of the cluster
+	Name    string
+	Role    *iam.Role
+	Cluster *eks.Cluster
+	// Kubeconfig authenticates with the AWS CLI as the identity using it
+	Kubeconfig pulumi.StringOutput
+	Endpoint   pulumi.StringOutput
+	// OidcIssuer is the issuer of the service account tokens of the cluster
+	OidcIssuer pulumi.StringOutput
+}
+
+// NewClusterComponent creates an EKS cluster authenticating with access
+// entries, encrypting its secrets with the encryption key when there is one
+func NewClusterComponent(ctx *pulumi.Context, name string, args *ClusterComponentArgs, opts ...pulumi.ResourceOption) (*ClusterComponent, error) {
+	component := &ClusterComponent{Name: args.Name}
+	err := ctx.RegisterComponentResource("infra:index:ClusterComponent", name, component, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpJSON0, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Action": []string{
+					"sts:AssumeRole",
+					"sts:TagSession",
+				},
+				"Effect": "Allow",
+				"Principal": map[string]any{
+					"Service": "eks.amazonaws.com",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	component.Role, err = iam.NewRole(ctx, "cluster-role", &iam.RoleArgs{
+		Name:             pulumi.String(args.RoleName),
+		AssumeRolePolicy: pulumi.String(string(tmpJSON0)),
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterAmazonEKSClusterPolicy, err := iam.NewRolePolicyAttachment(ctx, "cluster-AmazonEKSClusterPolicy", &iam.RolePolicyAttachmentArgs{
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/AmazonEKSClusterPolicy"),
+		Role:      component.Role.Name,
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies := []pulumi.Resource{clusterAmazonEKSClusterPolicy}
+	var encryptionConfig eks.ClusterEncryptionConfigPtrInput
+	if args.EncryptionKeyArn != nil {
+		keyPolicy := args.EncryptionKeyArn.ToStringOutput().ApplyT(func(keyArn string) (string, error) {
+			tmpJSON1, err := json.Marshal(map[string]any{
+				"Version": "2012-10-17",
+				"Statement": []map[string]any{
+					{
+						"Action": []string{
+							"kms:Encrypt",
+							"kms:Decrypt",
+							"kms:ListGrants",
+							"kms:DescribeKey",
+						},
+						"Effect":   "Allow",
+						"Resource": keyArn,
+					},
+				},
+			})
+			return string(tmpJSON1), err
+		}).(pulumi.StringOutput)
+
+		clusterKmsPolicy, err := iam.NewRolePolicy(ctx, "cluster-kms-policy", &iam.RolePolicyArgs{
+			Role:   component.Role.Name,
+			Policy: keyPolicy,
+		}, childOptions(component)...)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, clusterKmsPolicy)
+
+		encryptionConfig = &eks.ClusterEncryptionConfigArgs{
+			Provider: &eks.ClusterEncryptionConfigProviderArgs{
+				KeyArn: args.EncryptionKeyArn,
+			},
+			Resources: pulumi.StringArray{
+				pulumi.String("secrets"),
+			},
+		}
+	}
+
+	component.Cluster, err = eks.NewCluster(ctx, args.Name, &eks.ClusterArgs{
+		Name: pulumi.String(args.Name),
+		AccessConfig: &eks.ClusterAccessConfigArgs{
+			AuthenticationMode: pulumi.String("API"),
+		},
+		EncryptionConfig: encryptionConfig,
+		RoleArn:          component.Role.Arn,
+		Version:          pulumi.String(args.Version),
+		VpcConfig: &eks.ClusterVpcConfigArgs{
+			SubnetIds: args.SubnetIds,
+		},
+	}, childOptions(component, pulumi.DependsOn(dependencies))...)
+	if err != nil {
+		return nil, err
+	}
+
+	component.Kubeconfig = newKubeconfig(component.Cluster, args.Region)
+	component.Endpoint = component.Cluster.Endpoint
+	component.OidcIssuer = component.Cluster.Identities.Index(pulumi.Int(0)).Oidcs().Index(pulumi.Int(0)).Issuer().Elem()
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"kubeconfig": component.Kubeconfig,
+		"endpoint":   component.Endpoint,
+		"oidcIssuer": component.OidcIssuer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return component, nil
+}
+
+// newKubeconfig returns a kubeconfig for the cluster, authenticating with
+// the AWS CLI as the identity running the program
+func newKubeconfig(cluster *eks.Cluster, region string) pulumi.StringOutput {
+	return pulumi.All(cluster.Name, cluster.Endpoint, cluster.CertificateAuthority.Data().Elem()).ApplyT(func(values []any) (string, error) {
+		name, endpoint, certificateAuthority := values[0].(string), values[1].(string), values[2].(string)
+		tmpJSON0, err := json.Marshal(map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Config",
+			"clusters": []map[string]any{
+				{
+					"name": name,
+					"cluster": map[string]any{
+						"server":                     endpoint,
+						"certificate-authority-data": certificateAuthority,
+					},
+				},
+			},
+			"contexts": []map[string]any{
+				{
+					"name": name,
+					"context": map[string]any{
+						"cluster": name,
+						"user":    name,
+					},
+				},
+			},
+			"current-context": name,
+			"users": []map[string]any{
+				{
+					"name": name,
+					"user": map[string]any{
+						"exec": map[string]any{
+							"apiVersion": "client.authentication.k8s.io/v1beta1",
+							"command":    "aws",
+							"args":       []string{"eks", "get-token", "--cluster-name", name, "--region", region},
+						},
+					},
+				},
+			},
+		})
+		return string(tmpJSON0), err
+	}).(pulumi.StringOutput)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestClusterComponent(t *testing.T) {
+	var kubeconfig, issuer string
+	var resolved sync.WaitGroup
+	resolved.Add(1)
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		cluster, err := newTestCluster(ctx)
+		if err != nil {
+			return err
+		}
+		pulumi.All(cluster.Kubeconfig, cluster.OidcIssuer).ApplyT(func(values []any) []any {
+			defer resolved.Done()
+			kubeconfig, issuer = values[0].(string), values[1].(string)
+			return values
+		})
+		return nil
+	})
+	resolved.Wait()
+
+	t.Run("cluster", func(t *testing.T) {
+		role := m.inputs(t, "aws:iam/role:Role", "cluster-role")
+		if name := role["name"].StringValue(); name != "eksClusterRole" {
+			t.Errorf("role name = %q, want eksClusterRole", name)
+		}
+		m.inputs(t, "aws:iam/rolePolicyAttachment:RolePolicyAttachment", "cluster-AmazonEKSClusterPolicy")
+
+		cluster := m.inputs(t, "aws:eks/cluster:Cluster", "test-eks")
+		if version := cluster["version"].StringValue(); version != "1.33" {
+			t.Errorf("version = %q, want 1.33", version)
+		}
+		if subnets := stringsOf(cluster["vpcConfig"].ObjectValue()["subnetIds"]); !slices.Equal(subnets, []string{"subnet-a"}) {
+			t.Errorf("subnets = %v, want subnet-a", subnets)
+		}
+		if mode := cluster["accessConfig"].ObjectValue()["authenticationMode"].StringValue(); mode != "API" {
+			t.Errorf("authentication mode = %q, want API", mode)
+		}
+	})
+
+	t.Run("kubeconfig", func(t *testing.T) {
+		var config struct {
+			Clusters []struct {
+				Cluster struct{ Server string }
+			}
+			Users []struct {
+				User struct {
+					Exec struct {
+						Command string
+						Args    []string
+					}
+				}
+			}
+		}
+		if err := json.Unmarshal([]byte(kubeconfig), &config); err != nil {
+			t.Fatal(err)
+		}
+		if len(config.Clusters) != 1 || config.Clusters[0].Cluster.Server != "https://test-eks.eks.example.com" {
+			t.Errorf("clusters = %+v, want the cluster endpoint", config.Clusters)
+		}
+		if len(config.Users) != 1 {
+			t.Fatalf("%d users, want 1", len(config.Users))
+		}
+		exec := config.Users[0].User.Exec
+		want := []string{"eks", "get-token", "--cluster-name", "test-eks", "--region", "us-east-1"}
+		if exec.Command != "aws" || !slices.Equal(exec.Args, want) {
+			t.Errorf("exec = %s %v, want aws %v", exec.Command, exec.Args, want)
+		}
+	})
+
+	t.Run("OIDC issuer", func(t *testing.T) {
+		if issuer != "https://oidc.eks.us-east-1.amazonaws.com/id/test-eks" {
+			t.Errorf("issuer = %q, want the issuer of the cluster", issuer)
+		}
+	})
+}
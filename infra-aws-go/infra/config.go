@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+var (
+	clusterNamePattern = regexp.MustCompile(`^[0-9A-Za-z][A-Za-z0-9_-]{0,99}$`)
+	versionPattern     = regexp.MustCompile(`^1\.[0-9]+$`)
+	roleNamePattern    = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+	namespacePattern   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	subdomainPattern   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	secretArnPattern   = regexp.MustCompile(`^arn:aws[a-z-]*:secretsmanager:[a-z0-9-]+:[0-9]{12}:secret:`)
+	secretNamePattern  = regexp.MustCompile(`^[A-Za-z0-9/_+=.@-]+$`)
+)
+
+// vpcConfig selects the network of the cluster, read from the "vpc" stack
+// config. The default VPC is used unless Create is set.
+type vpcConfig struct {
+	Create    bool   `json:"create"`
+	CidrBlock string `json:"cidrBlock"`
+	// SingleNatGateway shares one NAT gateway between the private subnets,
+	// cheaper but not highly available
+	SingleNatGateway bool `json:"singleNatGateway"`
+}
+
+// syncLambdaConfig configures the sync Lambda, read from the "syncLambda"
+// stack config
+type syncLambdaConfig struct {
+	// Source is the directory of the Lambda, relative to the program
+	Source         string   `json:"source"`
+	SecretPrefix   string   `json:"secretPrefix"`
+	Namespaces     []string `json:"namespaces"`
+	ResyncSchedule string   `json:"resyncSchedule"`
+	// Mode is write, where the Lambda writes the Secrets, or nudge, where it
+	// has the operator sync the SecretManagers reading the secret
+	Mode string `json:"mode"`
+}
+
+// operatorConfig configures the identity and the deployment of the
+// operator, read from the "operator" stack config
+type operatorConfig struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	// SecretArnPrefix limits the secrets the operator may read. It defaults
+	// to the secrets of the sync Lambda, in the region and account of the
+	// stack.
+	SecretArnPrefix string `json:"secretArnPrefix"`
+	// Image is the image of the manager. The operator is deployed into the
+	// cluster when it is set.
+	Image string `json:"image"`
+	// Manifests is the kustomize config directory of the operator, relative
+	// to the program
+	Manifests string `json:"manifests"`
+	// Samples are created as my.domain/v2 SecretManagers. Without the
+	// webhooks, which need cert-manager, the CRD serves only v2, its storage
+	// version: my.domain/v1 objects are rejected by the API server.
+	Samples []operatorSample `json:"samples"`
+}
+
+// stackConfig is the configuration of a stack
+type stackConfig struct {
+	Region            string
+	ClusterName       string
+	KubernetesVersion string
+	AvailabilityZones []string
+	ClusterRoleName   string
+	NodeRoleName      string
+	Vpc               vpcConfig
+	Nodes             nodeGroupConfig
+	SyncLambda        syncLambdaConfig
+	Operator          operatorConfig
+	// Secrets are created encrypted with the secrets key, read from the
+	// "secrets" stack config
+	Secrets []managedSecret
+}
+
+// loadStackConfig reads the stack config, applies the defaults and
+// validates the result
+func loadStackConfig(ctx *pulumi.Context) (*stackConfig, error) {
+	cfg := config.New(ctx, "")
+	region := config.Require(ctx, "aws:region")
+
+	stack := &stackConfig{
+		Region:            region,
+		ClusterName:       getOrDefault(cfg, "clusterName", "demo-eks"),
+		KubernetesVersion: getOrDefault(cfg, "kubernetesVersion", "1.33"),
+		AvailabilityZones: []string{region + "a", region + "b"},
+		ClusterRoleName:   getOrDefault(cfg, "clusterRoleName", "eksClusterRole"),
+		NodeRoleName:      getOrDefault(cfg, "nodeRoleName", "nodeRole"),
+		Vpc: vpcConfig{
+			CidrBlock: "10.0.0.0/16",
+		},
+		Nodes: defaultNodeGroupConfig(),
+		SyncLambda: syncLambdaConfig{
+			Source:         "../cmd",
+			SecretPrefix:   "eks-sync-",
+			Namespaces:     []string{"default"},
+			ResyncSchedule: "rate(1 hour)",
+			Mode:           "write",
+		},
+		Operator: operatorConfig{
+			Namespace:      "secret-manager-system",
+			ServiceAccount: "secret-manager-controller-manager",
+			Manifests:      "../../secret-manager/config",
+		},
+	}
+
+	for key, value := range map[string]any{
+		"availabilityZones": &stack.AvailabilityZones,
+		"vpc":               &stack.Vpc,
+		"nodes":             &stack.Nodes,
+		"syncLambda":        &stack.SyncLambda,
+		"operator":          &stack.Operator,
+		"secrets":           &stack.Secrets,
+	} {
+		if err := cfg.GetObject(key, value); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", key, err)
+		}
+	}
+
+	if err := stack.validate(); err != nil {
+		return nil, err
+	}
+	return stack, nil
+}
+
+func getOrDefault(cfg *config.Config, key, defaultValue string) string {
+	if value := cfg.Get(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// validate checks the config before any resource is created
+func (c *stackConfig) validate() error {
+	if !clusterNamePattern.MatchString(c.ClusterName) {
+		return fmt.Errorf("clusterName %q is not a valid EKS cluster name", c.ClusterName)
+	}
+	if !versionPattern.MatchString(c.KubernetesVersion) {
+		return fmt.Errorf("kubernetesVersion must look like 1.33, got %q", c.KubernetesVersion)
+	}
+	if len(c.AvailabilityZones) < 2 {
+		return fmt.Errorf("EKS needs at least 2 availabilityZones, got %d", len(c.AvailabilityZones))
+	}
+	for _, zone := range c.AvailabilityZones {
+		if !strings.HasPrefix(zone, c.Region) {
+			return fmt.Errorf("availability zone %q is not in region %s", zone, c.Region)
+		}
+	}
+	for key, name := range map[string]string{"clusterRoleName": c.ClusterRoleName, "nodeRoleName": c.NodeRoleName} {
+		if !roleNamePattern.MatchString(name) {
+			return fmt.Errorf("%s %q is not a valid IAM role name", key, name)
+		}
+	}
+	if c.Vpc.Create {
+		if err := c.Vpc.validate(len(c.AvailabilityZones)); err != nil {
+			return err
+		}
+	}
+	if err := c.Nodes.validate(); err != nil {
+		return err
+	}
+	if err := c.SyncLambda.validate(); err != nil {
+		return err
+	}
+	if err := c.Operator.validate(); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, secret := range c.Secrets {
+		name := c.SyncLambda.SecretPrefix + secret.Name
+		if secret.Name == "" || len(name) > 512 || !secretNamePattern.MatchString(name) {
+			return fmt.Errorf("secrets: %q is not a valid Secrets Manager secret name", name)
+		}
+		if names[name] {
+			return fmt.Errorf("secrets: %s is defined twice", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// validate checks the VPC CIDR block fits a public and a private subnet per
+// availability zone
+func (c vpcConfig) validate(zones int) error {
+	ip, network, err := net.ParseCIDR(c.CidrBlock)
+	if err != nil || ip.To4() == nil {
+		return fmt.Errorf("vpc: cidrBlock %q is not an IPv4 CIDR block", c.CidrBlock)
+	}
+	if ones, _ := network.Mask.Size(); ones < 16 || ones > 24 {
+		return fmt.Errorf("vpc: cidrBlock must be between /16 and /24, got /%d", ones)
+	}
+	if 2*zones > 1<<subnetBits {
+		return fmt.Errorf("vpc: %d availability zones do not fit in the VPC", zones)
+	}
+	return nil
+}
+
+func (c syncLambdaConfig) validate() error {
+	if c.Source == "" {
+		return fmt.Errorf("syncLambda: source is required")
+	}
+	if c.SecretPrefix == "" {
+		return fmt.Errorf("syncLambda: secretPrefix is required, the Lambda may not read every secret")
+	}
+	if len(c.Namespaces) == 0 {
+		return fmt.Errorf("syncLambda: at least one namespace is required")
+	}
+	for _, namespace := range c.Namespaces {
+		if len(namespace) > 63 || !namespacePattern.MatchString(namespace) {
+			return fmt.Errorf("syncLambda: namespace %q is not a valid Kubernetes namespace", namespace)
+		}
+	}
+	if !strings.HasPrefix(c.ResyncSchedule, "rate(") && !strings.HasPrefix(c.ResyncSchedule, "cron(") {
+		return fmt.Errorf("syncLambda: resyncSchedule must be a rate() or cron() expression, got %q", c.ResyncSchedule)
+	}
+	if c.Mode != "write" && c.Mode != "nudge" {
+		return fmt.Errorf("syncLambda: mode must be write or nudge, got %q", c.Mode)
+	}
+	return nil
+}
+
+func (c operatorConfig) validate() error {
+	if len(c.Namespace) > 63 || !namespacePattern.MatchString(c.Namespace) {
+		return fmt.Errorf("operator: namespace %q is not a valid Kubernetes namespace", c.Namespace)
+	}
+	if len(c.ServiceAccount) > 253 || !subdomainPattern.MatchString(c.ServiceAccount) {
+		return fmt.Errorf("operator: serviceAccount %q is not a valid Kubernetes name", c.ServiceAccount)
+	}
+	if c.SecretArnPrefix != "" && !secretArnPattern.MatchString(c.SecretArnPrefix) {
+		return fmt.Errorf("operator: secretArnPrefix %q is not a Secrets Manager secret ARN prefix", c.SecretArnPrefix)
+	}
+	if c.Image == "" {
+		if len(c.Samples) > 0 {
+			return fmt.Errorf("operator: samples need the operator, set its image")
+		}
+		return nil
+	}
+	if c.Manifests == "" {
+		return fmt.Errorf("operator: manifests is required to deploy the operator")
+	}
+	for _, sample := range c.Samples {
+		if len(sample.Name) > 253 || !subdomainPattern.MatchString(sample.Name) {
+			return fmt.Errorf("operator: sample name %q is not a valid Kubernetes name", sample.Name)
+		}
+		if len(sample.Namespace) > 63 || !namespacePattern.MatchString(sample.Namespace) {
+			return fmt.Errorf("operator: sample %s has invalid namespace %q", sample.Name, sample.Namespace)
+		}
+		if len(sample.Spec) == 0 {
+			return fmt.Errorf("operator: sample %s has no spec", sample.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// loadWithConfig runs loadStackConfig with the stack config in values
+func loadWithConfig(t *testing.T, values string) (*stackConfig, error) {
+	t.Helper()
+	t.Setenv("PULUMI_CONFIG", values)
+
+	var cfg *stackConfig
+	var loadErr error
+	runWithMocks(t, func(ctx *pulumi.Context) error {
+		cfg, loadErr = loadStackConfig(ctx)
+		return nil
+	})
+	return cfg, loadErr
+}
+
+func TestLoadStackConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := loadWithConfig(t, `{"aws:region": "eu-west-1"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.ClusterName != "demo-eks" || cfg.KubernetesVersion != "1.33" {
+			t.Errorf("cluster = %s %s, want demo-eks 1.33", cfg.ClusterName, cfg.KubernetesVersion)
+		}
+		if !slices.Equal(cfg.AvailabilityZones, []string{"eu-west-1a", "eu-west-1b"}) {
+			t.Errorf("availability zones = %v, want the first two of the region", cfg.AvailabilityZones)
+		}
+		if cfg.Vpc.Create {
+			t.Error("the default VPC should be used by default")
+		}
+		if cfg.SyncLambda.SecretPrefix != "eks-sync-" || !slices.Equal(cfg.SyncLambda.Namespaces, []string{"default"}) {
+			t.Errorf("sync Lambda = %+v, want the eks-sync- prefix into default", cfg.SyncLambda)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		cfg, err := loadWithConfig(t, `{
+			"aws:region": "us-east-1",
+			"infra:clusterName": "prod",
+			"infra:kubernetesVersion": "1.32",
+			"infra:availabilityZones": "[\"us-east-1a\", \"us-east-1b\", \"us-east-1c\"]",
+			"infra:vpc": "{\"create\": true, \"cidrBlock\": \"10.20.0.0/16\"}",
+			"infra:nodes": "{\"capacityType\": \"SPOT\"}",
+			"infra:syncLambda": "{\"namespaces\": [\"apps\"]}"
+		}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.ClusterName != "prod" || cfg.KubernetesVersion != "1.32" || len(cfg.AvailabilityZones) != 3 {
+			t.Errorf("cluster = %s %s in %v", cfg.ClusterName, cfg.KubernetesVersion, cfg.AvailabilityZones)
+		}
+		if !cfg.Vpc.Create || cfg.Vpc.CidrBlock != "10.20.0.0/16" {
+			t.Errorf("vpc = %+v, want a dedicated 10.20.0.0/16", cfg.Vpc)
+		}
+		// Objects are merged into the defaults
+		if cfg.Nodes.CapacityType != "SPOT" || !slices.Equal(cfg.Nodes.InstanceTypes, []string{"t3.medium"}) {
+			t.Errorf("nodes = %+v, want default SPOT nodes", cfg.Nodes)
+		}
+		if cfg.SyncLambda.SecretPrefix != "eks-sync-" || !slices.Equal(cfg.SyncLambda.Namespaces, []string{"apps"}) {
+			t.Errorf("sync Lambda = %+v, want the eks-sync- prefix into apps", cfg.SyncLambda)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := loadWithConfig(t, `{"aws:region": "us-east-1", "infra:clusterName": "-prod"}`)
+		if err == nil || !strings.Contains(err.Error(), "clusterName") {
+			t.Fatalf("error = %v, want an invalid clusterName", err)
+		}
+	})
+}
+
+func TestStackConfigValidate(t *testing.T) {
+	valid := func() *stackConfig {
+		return &stackConfig{
+			Region:            "us-east-1",
+			ClusterName:       "demo-eks",
+			KubernetesVersion: "1.33",
+			AvailabilityZones: []string{"us-east-1a", "us-east-1b"},
+			ClusterRoleName:   "eksClusterRole",
+			NodeRoleName:      "nodeRole",
+			Vpc:               vpcConfig{CidrBlock: "10.0.0.0/16"},
+			Nodes:             defaultNodeGroupConfig(),
+			SyncLambda: syncLambdaConfig{
+				Source:         "../cmd",
+				SecretPrefix:   "eks-sync-",
+				Namespaces:     []string{"default"},
+				ResyncSchedule: "rate(1 hour)",
+				Mode:           "write",
+			},
+			Operator: operatorConfig{
+				Namespace:      "secret-manager-system",
+				ServiceAccount: "secret-manager-controller-manager",
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*stackConfig)
+		err    string
+	}{
+		{"valid", func(*stackConfig) {}, ""},
+		{"dedicated VPC", func(c *stackConfig) { c.Vpc.Create = true }, ""},
+		{"cluster name", func(c *stackConfig) { c.ClusterName = "demo eks" }, "clusterName"},
+		{"version", func(c *stackConfig) { c.KubernetesVersion = "v1.33" }, "kubernetesVersion"},
+		{"single zone", func(c *stackConfig) { c.AvailabilityZones = []string{"us-east-1a"} }, "at least 2"},
+		{"zone in another region", func(c *stackConfig) { c.AvailabilityZones[1] = "eu-west-1a" }, "not in region"},
+		{"role name", func(c *stackConfig) { c.NodeRoleName = "node role" }, "nodeRoleName"},
+		{"VPC CIDR block", func(c *stackConfig) { c.Vpc = vpcConfig{Create: true, CidrBlock: "10.0.0.0"} }, "cidrBlock"},
+		{"VPC too small", func(c *stackConfig) { c.Vpc = vpcConfig{Create: true, CidrBlock: "10.0.0.0/26"} }, "between /16 and /24"},
+		{"CIDR block ignored without a VPC", func(c *stackConfig) { c.Vpc.CidrBlock = "" }, ""},
+		{"nodes", func(c *stackConfig) { c.Nodes.CapacityType = "spot" }, "capacityType"},
+		{"no secret prefix", func(c *stackConfig) { c.SyncLambda.SecretPrefix = "" }, "secretPrefix"},
+		{"no namespace", func(c *stackConfig) { c.SyncLambda.Namespaces = nil }, "at least one namespace"},
+		{"namespace", func(c *stackConfig) { c.SyncLambda.Namespaces = []string{"Apps"} }, "not a valid Kubernetes namespace"},
+		{"schedule", func(c *stackConfig) { c.SyncLambda.ResyncSchedule = "1 hour" }, "resyncSchedule"},
+		{"nudge mode", func(c *stackConfig) { c.SyncLambda.Mode = "nudge" }, ""},
+		{"mode", func(c *stackConfig) { c.SyncLambda.Mode = "push" }, "mode must be write or nudge"},
+		{"operator namespace", func(c *stackConfig) { c.Operator.Namespace = "" }, "operator: namespace"},
+		{"service account", func(c *stackConfig) { c.Operator.ServiceAccount = "Manager" }, "serviceAccount"},
+		{"secret ARN prefix", func(c *stackConfig) {
+			c.Operator.SecretArnPrefix = "arn:aws:secretsmanager:us-east-1:111111111111:secret:apps/"
+		}, ""},
+		{"not a secret ARN prefix", func(c *stackConfig) { c.Operator.SecretArnPrefix = "*" }, "secretArnPrefix"},
+		{"samples without the operator", func(c *stackConfig) {
+			c.Operator.Samples = []operatorSample{{Name: "db", Namespace: "apps", Spec: map[string]any{"target": "db"}}}
+		}, "set its image"},
+		{"samples", func(c *stackConfig) {
+			c.Operator.Image, c.Operator.Manifests = "secret-manager:v1", "../../secret-manager/config"
+			c.Operator.Samples = []operatorSample{{Name: "db", Namespace: "apps", Spec: map[string]any{"target": "db"}}}
+		}, ""},
+		{"sample without a spec", func(c *stackConfig) {
+			c.Operator.Image, c.Operator.Manifests = "secret-manager:v1", "../../secret-manager/config"
+			c.Operator.Samples = []operatorSample{{Name: "db", Namespace: "apps"}}
+		}, "no spec"},
+		{"secrets", func(c *stackConfig) {
+			c.Secrets = []managedSecret{{Name: "db"}, {Name: "apps/api", Description: "API token"}}
+		}, ""},
+		{"secret name", func(c *stackConfig) { c.Secrets = []managedSecret{{Name: "db password"}} }, "not a valid Secrets Manager secret name"},
+		{"secret defined twice", func(c *stackConfig) { c.Secrets = []managedSecret{{Name: "db"}, {Name: "db"}} }, "defined twice"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := valid()
+			test.modify(cfg)
+			err := cfg.validate()
+			if test.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("error = %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
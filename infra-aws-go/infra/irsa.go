@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// operatorRoleArgs configures the IAM role of the operator
+type operatorRoleArgs struct {
+	Cluster *ClusterComponent
+	// Namespace and ServiceAccount are the service account of the operator
+	// allowed to assume the role
+	Namespace      string
+	ServiceAccount string
+	// SecretArnPrefix limits the secrets the operator may read
+	SecretArnPrefix string
+}
+
+// operatorRole is the role of the operator and the OIDC provider trusted to
+// issue its web identities
+type operatorRole struct {
+	Provider *iam.OpenIdConnectProvider
+	Role     *iam.Role
+}
+
+// newOperatorRole creates an OIDC provider for the cluster, and a role the
+// operator service account assumes through IAM roles for service accounts.
+// The role is annotated on the service account as eks.amazonaws.com/role-arn.
+func newOperatorRole(ctx *pulumi.Context, args *operatorRoleArgs) (*operatorRole, error) {
+	provider, err := iam.NewOpenIdConnectProvider(ctx, "cluster-oidc-provider", &iam.OpenIdConnectProviderArgs{
+		Url: args.Cluster.OidcIssuer,
+		ClientIdLists: pulumi.StringArray{
+			pulumi.String("sts.amazonaws.com"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	subject := "system:serviceaccount:" + args.Namespace + ":" + args.ServiceAccount
+	assumeRolePolicy := pulumi.All(provider.Arn, args.Cluster.OidcIssuer).ApplyT(func(values []any) (string, error) {
+		providerArn, issuer := values[0].(string), strings.TrimPrefix(values[1].(string), "https://")
+		tmpJSON0, err := json.Marshal(map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{
+					"Action": "sts:AssumeRoleWithWebIdentity",
+					"Effect": "Allow",
+					"Principal": map[string]any{
+						"Federated": providerArn,
+					},
+					"Condition": map[string]any{
+						"StringEquals": map[string]any{
+							issuer + ":sub": subject,
+							issuer + ":aud": "sts.amazonaws.com",
+						},
+					},
+				},
+			},
+		})
+		return string(tmpJSON0), err
+	}).(pulumi.StringOutput)
+
+	role, err := iam.NewRole(ctx, "operator-role", &iam.RoleArgs{
+		AssumeRolePolicy: assumeRolePolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpJSON1, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Action": []string{
+					"secretsmanager:GetSecretValue",
+					"secretsmanager:DescribeSecret",
+				},
+				"Effect":   "Allow",
+				"Resource": args.SecretArnPrefix + "*",
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = iam.NewRolePolicy(ctx, "operator-policy", &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: pulumi.String(string(tmpJSON1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &operatorRole{Provider: provider, Role: role}, nil
+}
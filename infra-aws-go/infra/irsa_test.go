@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestOperatorRole(t *testing.T) {
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		cluster, err := newTestCluster(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = newOperatorRole(ctx, &operatorRoleArgs{
+			Cluster:         cluster,
+			Namespace:       "secret-manager-system",
+			ServiceAccount:  "secret-manager-controller-manager",
+			SecretArnPrefix: "arn:aws:secretsmanager:us-east-1:111111111111:secret:apps/",
+		})
+		return err
+	})
+
+	const issuer = "oidc.eks.us-east-1.amazonaws.com/id/test-eks"
+
+	t.Run("OIDC provider", func(t *testing.T) {
+		provider := m.inputs(t, "aws:iam/openIdConnectProvider:OpenIdConnectProvider", "cluster-oidc-provider")
+		if url := provider["url"].StringValue(); url != "https://"+issuer {
+			t.Errorf("url = %q, want the cluster issuer", url)
+		}
+	})
+
+	t.Run("trusted by the service account only", func(t *testing.T) {
+		var policy struct {
+			Statement []struct {
+				Action    string
+				Principal struct{ Federated string }
+				Condition struct{ StringEquals map[string]string }
+			}
+		}
+		document := m.inputs(t, "aws:iam/role:Role", "operator-role")["assumeRolePolicy"].StringValue()
+		if err := json.Unmarshal([]byte(document), &policy); err != nil {
+			t.Fatal(err)
+		}
+		if len(policy.Statement) != 1 {
+			t.Fatalf("%d statements, want 1", len(policy.Statement))
+		}
+		statement := policy.Statement[0]
+		if statement.Action != "sts:AssumeRoleWithWebIdentity" {
+			t.Errorf("action = %s, want sts:AssumeRoleWithWebIdentity", statement.Action)
+		}
+		if statement.Principal.Federated != "arn:aws:mock::111111111111:cluster-oidc-provider" {
+			t.Errorf("principal = %s, want the OIDC provider", statement.Principal.Federated)
+		}
+		want := map[string]string{
+			issuer + ":sub": "system:serviceaccount:secret-manager-system:secret-manager-controller-manager",
+			issuer + ":aud": "sts.amazonaws.com",
+		}
+		for key, value := range want {
+			if statement.Condition.StringEquals[key] != value {
+				t.Errorf("condition %s = %q, want %q", key, statement.Condition.StringEquals[key], value)
+			}
+		}
+	})
+
+	t.Run("read only access to the secrets", func(t *testing.T) {
+		var policy struct {
+			Statement []struct {
+				Action   []string
+				Resource string
+			}
+		}
+		document := m.inputs(t, "aws:iam/rolePolicy:RolePolicy", "operator-policy")["policy"].StringValue()
+		if err := json.Unmarshal([]byte(document), &policy); err != nil {
+			t.Fatal(err)
+		}
+		if len(policy.Statement) != 1 {
+			t.Fatalf("%d statements, want 1", len(policy.Statement))
+		}
+		statement := policy.Statement[0]
+		if len(statement.Action) != 2 || statement.Action[0] != "secretsmanager:GetSecretValue" || statement.Action[1] != "secretsmanager:DescribeSecret" {
+			t.Errorf("actions = %v, want GetSecretValue and DescribeSecret", statement.Action)
+		}
+		if statement.Resource != "arn:aws:secretsmanager:us-east-1:111111111111:secret:apps/*" {
+			t.Errorf("resource = %s, want the configured prefix", statement.Resource)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kms"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// managedSecret is a Secrets Manager secret created by the program,
+// encrypted with the secrets key. Its value is left to whoever writes it.
+type managedSecret struct {
+	// Name is appended to the secret prefix of the sync Lambda
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// newSecretsKey creates the customer managed key encrypting the Kubernetes
+// secrets of the cluster and the managed secrets. It starts with the default
+// key policy, which delegates its use to IAM, until newSecretsKeyPolicy
+// replaces it: the roles decrypting with it depend on the cluster, which
+// depends on the key.
+func newSecretsKey(ctx *pulumi.Context, clusterName string) (*kms.Key, error) {
+	key, err := kms.NewKey(ctx, "secrets-key", &kms.KeyArgs{
+		Description:       pulumi.String("Envelope encryption of the secrets of " + clusterName),
+		EnableKeyRotation: pulumi.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = kms.NewAlias(ctx, "secrets-key-alias", &kms.AliasArgs{
+		Name:        pulumi.String("alias/" + clusterName + "-secrets"),
+		TargetKeyId: key.Arn,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// secretsKeyPolicyArgs configures the key policy of the secrets key
+type secretsKeyPolicyArgs struct {
+	Key       *kms.Key
+	Region    string
+	AccountID string
+	// Decrypters are the ARNs of the roles reading the managed secrets
+	Decrypters []pulumi.StringInput
+}
+
+// newSecretsKeyPolicy replaces the default policy of the secrets key. The
+// account keeps administering the key through IAM, and the decrypters may
+// decrypt with it through Secrets Manager only.
+func newSecretsKeyPolicy(ctx *pulumi.Context, args *secretsKeyPolicyArgs) (*kms.KeyPolicy, error) {
+	decrypters := make([]any, len(args.Decrypters))
+	for i, decrypter := range args.Decrypters {
+		decrypters[i] = decrypter
+	}
+	policy := pulumi.All(decrypters...).ApplyT(func(values []any) (string, error) {
+		tmpJSON0, err := json.Marshal(map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{
+					"Sid":    "AccountAdministration",
+					"Action": "kms:*",
+					"Effect": "Allow",
+					"Principal": map[string]any{
+						"AWS": "arn:aws:iam::" + args.AccountID + ":root",
+					},
+					"Resource": "*",
+				},
+				{
+					"Sid": "SecretsDecryption",
+					"Action": []string{
+						"kms:Decrypt",
+						"kms:DescribeKey",
+					},
+					"Effect": "Allow",
+					"Principal": map[string]any{
+						"AWS": values,
+					},
+					"Resource": "*",
+					"Condition": map[string]any{
+						"StringEquals": map[string]any{
+							"kms:ViaService": "secretsmanager." + args.Region + ".amazonaws.com",
+						},
+					},
+				},
+			},
+		})
+		return string(tmpJSON0), err
+	}).(pulumi.StringOutput)
+
+	return kms.NewKeyPolicy(ctx, "secrets-key-policy", &kms.KeyPolicyArgs{
+		KeyId:  args.Key.Arn,
+		Policy: policy,
+	})
+}
+
+// newManagedSecrets creates the managed secrets under the secret prefix,
+// encrypted with the secrets key
+func newManagedSecrets(ctx *pulumi.Context, key *kms.Key, secretPrefix string, secrets []managedSecret) error {
+	for _, secret := range secrets {
+		_, err := secretsmanager.NewSecret(ctx, "secret-"+secret.Name, &secretsmanager.SecretArgs{
+			Name:        pulumi.String(secretPrefix + secret.Name),
+			Description: pulumi.String(secret.Description),
+			KmsKeyId:    key.Arn,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
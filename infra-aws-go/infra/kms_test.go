@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestSecretsKey(t *testing.T) {
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		key, err := newSecretsKey(ctx, "test-eks")
+		if err != nil {
+			return err
+		}
+
+		_, err = NewClusterComponent(ctx, "cluster", &ClusterComponentArgs{
+			Name:             "test-eks",
+			Version:          "1.33",
+			RoleName:         "eksClusterRole",
+			Region:           "us-east-1",
+			SubnetIds:        pulumi.ToStringArray([]string{"subnet-a"}),
+			EncryptionKeyArn: key.Arn,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = newSecretsKeyPolicy(ctx, &secretsKeyPolicyArgs{
+			Key:       key,
+			Region:    "us-east-1",
+			AccountID: "111111111111",
+			Decrypters: []pulumi.StringInput{
+				pulumi.String("arn:aws:iam::111111111111:role/operator"),
+				pulumi.String("arn:aws:iam::111111111111:role/sync-lambda"),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		return newManagedSecrets(ctx, key, "eks-sync-", []managedSecret{{Name: "db", Description: "Database credentials"}})
+	})
+
+	const keyArn = "arn:aws:mock::111111111111:secrets-key"
+
+	t.Run("key", func(t *testing.T) {
+		key := m.inputs(t, "aws:kms/key:Key", "secrets-key")
+		if !key["enableKeyRotation"].BoolValue() {
+			t.Error("key rotation should be enabled")
+		}
+		if _, ok := key["policy"]; ok {
+			t.Error("the key policy should be left to the key policy resource")
+		}
+		alias := m.inputs(t, "aws:kms/alias:Alias", "secrets-key-alias")
+		if name := alias["name"].StringValue(); name != "alias/test-eks-secrets" {
+			t.Errorf("alias = %q, want alias/test-eks-secrets", name)
+		}
+	})
+
+	t.Run("cluster encryption", func(t *testing.T) {
+		cluster := m.inputs(t, "aws:eks/cluster:Cluster", "test-eks")
+		encryption := cluster["encryptionConfig"].ObjectValue()
+		if resources := stringsOf(encryption["resources"]); !slices.Equal(resources, []string{"secrets"}) {
+			t.Errorf("encrypted resources = %v, want secrets", resources)
+		}
+		if arn := encryption["provider"].ObjectValue()["keyArn"].StringValue(); arn != keyArn {
+			t.Errorf("key = %q, want the secrets key", arn)
+		}
+
+		var policy struct {
+			Statement []struct {
+				Action   []string
+				Resource string
+			}
+		}
+		document := m.inputs(t, "aws:iam/rolePolicy:RolePolicy", "cluster-kms-policy")["policy"].StringValue()
+		if err := json.Unmarshal([]byte(document), &policy); err != nil {
+			t.Fatal(err)
+		}
+		if len(policy.Statement) != 1 || policy.Statement[0].Resource != keyArn {
+			t.Fatalf("statements = %+v, want one on the secrets key", policy.Statement)
+		}
+		if !slices.Contains(policy.Statement[0].Action, "kms:Encrypt") || !slices.Contains(policy.Statement[0].Action, "kms:Decrypt") {
+			t.Errorf("actions = %v, want encrypt and decrypt", policy.Statement[0].Action)
+		}
+	})
+
+	t.Run("key policy", func(t *testing.T) {
+		var policy struct {
+			Statement []struct {
+				Sid       string
+				Action    any
+				Principal struct{ AWS any }
+				Condition struct{ StringEquals map[string]string }
+			}
+		}
+		keyPolicy := m.inputs(t, "aws:kms/keyPolicy:KeyPolicy", "secrets-key-policy")
+		if keyId := keyPolicy["keyId"].StringValue(); keyId != keyArn {
+			t.Errorf("key = %q, want the secrets key", keyId)
+		}
+		if err := json.Unmarshal([]byte(keyPolicy["policy"].StringValue()), &policy); err != nil {
+			t.Fatal(err)
+		}
+		if len(policy.Statement) != 2 {
+			t.Fatalf("%d statements, want 2", len(policy.Statement))
+		}
+		administration, decryption := policy.Statement[0], policy.Statement[1]
+		if administration.Principal.AWS != "arn:aws:iam::111111111111:root" || administration.Action != "kms:*" {
+			t.Errorf("administration = %+v, want the account", administration)
+		}
+		want := []any{"arn:aws:iam::111111111111:role/operator", "arn:aws:iam::111111111111:role/sync-lambda"}
+		if principals, _ := decryption.Principal.AWS.([]any); !slices.Equal(principals, want) {
+			t.Errorf("decrypters = %v, want %v", decryption.Principal.AWS, want)
+		}
+		if service := decryption.Condition.StringEquals["kms:ViaService"]; service != "secretsmanager.us-east-1.amazonaws.com" {
+			t.Errorf("via service = %q, want Secrets Manager", service)
+		}
+	})
+
+	t.Run("managed secrets", func(t *testing.T) {
+		secret := m.inputs(t, "aws:secretsmanager/secret:Secret", "secret-db")
+		if name := secret["name"].StringValue(); name != "eks-sync-db" {
+			t.Errorf("name = %q, want eks-sync-db", name)
+		}
+		if key := secret["kmsKeyId"].StringValue(); key != keyArn {
+			t.Errorf("key = %q, want the secrets key", key)
+		}
+	})
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/eks"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/lambda"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	rbacv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/rbac/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// syncEvents are the Secrets Manager events the sync Lambda handles
+var syncEvents = []string{
+	"PutSecretValue",
+	"UpdateSecret",
+	"RotationSucceeded",
+	"DeleteSecret",
+	"RestoreSecret",
+	"TagResource",
+	"UntagResource",
+}
+
+// syncLambdaGroup is the Kubernetes group of the sync Lambda in nudge mode
+const syncLambdaGroup = "secret-sync-lambda"
+
+// SyncLambdaComponentArgs configures the Lambda syncing AWS secrets into the
+// cluster
+type SyncLambdaComponentArgs struct {
+	Cluster   *ClusterComponent
+	Region    string
+	AccountID string
+	// Code holds the bootstrap binary of the Lambda, see buildSyncLambda
+	Code pulumi.Archive
+	// SecretPrefix is the name prefix of the secrets the Lambda may read
+	SecretPrefix string
+	// Namespaces are the namespaces the Lambda may write Secrets to. The
+	// first one is the namespace of secrets without a namespace tag; the
+	// others are the ones namespace tags may name.
+	Namespaces []string
+	// ResyncSchedule is the schedule expression of the full resync
+	ResyncSchedule string
+	// Mode is the SYNC_MODE of the Lambda, write or nudge
+	Mode string
+	// Provider is the Kubernetes provider of the cluster. In nudge mode the
+	// Lambda patches SecretManagers in every namespace, which the RBAC
+	// created with it allows.
+	Provider *kubernetes.Provider
+}
+
+// SyncLambdaComponent is the deployed sync Lambda
+type SyncLambdaComponent struct {
+	pulumi.ResourceState
+
+	Role     *iam.Role
+	Function *lambda.Function
+}
+
+// buildSyncLambda cross-compiles the Lambda in source for provided.al2023 on
+// arm64, and returns the archive holding its bootstrap binary
+func buildSyncLambda(source string) (pulumi.Archive, error) {
+	out, err := os.MkdirTemp("", "sync-lambda")
+	if err != nil {
+		return nil, err
+	}
+	bootstrap := filepath.Join(out, "bootstrap")
+
+	build := exec.Command("go", "build", "-tags", "lambda.norpc", "-trimpath", "-ldflags", "-s -w", "-o", bootstrap, ".")
+	build.Dir = source
+	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to build the sync Lambda in %s: %w\n%s", source, err, output)
+	}
+
+	return pulumi.NewAssetArchive(map[string]any{
+		"bootstrap": pulumi.NewFileAsset(bootstrap),
+	}), nil
+}
+
+// NewSyncLambdaComponent deploys the sync Lambda: its execution role, the
+// function, the EventBridge rules triggering it, and its access to the
+// cluster
+func NewSyncLambdaComponent(ctx *pulumi.Context, name string, args *SyncLambdaComponentArgs, opts ...pulumi.ResourceOption) (*SyncLambdaComponent, error) {
+	component := &SyncLambdaComponent{}
+	err := ctx.RegisterComponentResource("infra:index:SyncLambdaComponent", name, component, opts...)
+	if err != nil {
+		return nil, err
+	}
+	cluster := args.Cluster.Cluster
+
+	tmpJSON0, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Action": "sts:AssumeRole",
+				"Effect": "Allow",
+				"Principal": map[string]any{
+					"Service": "lambda.amazonaws.com",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := iam.NewRole(ctx, "sync-lambda-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(string(tmpJSON0)),
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = iam.NewRolePolicyAttachment(ctx, "sync-lambda-AWSLambdaBasicExecutionRole", &iam.RolePolicyAttachmentArgs{
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
+		Role:      role.Name,
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reading is limited to the synced secrets and describing to the cluster.
+	// ListSecrets, used by the resync, can not be limited to resources.
+	secretsArn := fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s*", args.Region, args.AccountID, args.SecretPrefix)
+	policy := cluster.Arn.ApplyT(func(clusterArn string) (string, error) {
+		tmpJSON1, err := json.Marshal(map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{
+					"Action": []string{
+						"secretsmanager:GetSecretValue",
+						"secretsmanager:DescribeSecret",
+					},
+					"Effect":   "Allow",
+					"Resource": secretsArn,
+				},
+				{
+					"Action":   "secretsmanager:ListSecrets",
+					"Effect":   "Allow",
+					"Resource": "*",
+				},
+				{
+					"Action":   "eks:DescribeCluster",
+					"Effect":   "Allow",
+					"Resource": clusterArn,
+				},
+			},
+		})
+		return string(tmpJSON1), err
+	}).(pulumi.StringOutput)
+
+	_, err = iam.NewRolePolicy(ctx, "sync-lambda-policy", &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: policy,
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := lambda.NewFunction(ctx, "sync-lambda", &lambda.FunctionArgs{
+		Runtime:       pulumi.String("provided.al2023"),
+		Handler:       pulumi.String("bootstrap"),
+		Architectures: pulumi.StringArray{pulumi.String("arm64")},
+		Code:          args.Code,
+		Role:          role.Arn,
+		MemorySize:    pulumi.Int(256),
+		Timeout:       pulumi.Int(300),
+		Environment: &lambda.FunctionEnvironmentArgs{
+			Variables: pulumi.StringMap{
+				"EKS_CLUSTER_NAMES":  cluster.Name,
+				"SECRET_PREFIX":      pulumi.String(args.SecretPrefix),
+				"K8S_NAMESPACE":      pulumi.String(args.Namespaces[0]),
+				"ALLOWED_NAMESPACES": pulumi.String(strings.Join(args.Namespaces, ",")),
+				"SYNC_MODE":          pulumi.String(args.Mode),
+			},
+		},
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Lambda authenticates to the cluster as its role, and may only
+	// write to the target namespaces
+	var groups pulumi.StringArray
+	if args.Mode == "nudge" {
+		groups = pulumi.StringArray{pulumi.String(syncLambdaGroup)}
+	}
+	accessEntry, err := eks.NewAccessEntry(ctx, "sync-lambda-access-entry", &eks.AccessEntryArgs{
+		ClusterName:      cluster.Name,
+		PrincipalArn:     role.Arn,
+		Type:             pulumi.String("STANDARD"),
+		KubernetesGroups: groups,
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = eks.NewAccessPolicyAssociation(ctx, "sync-lambda-access-policy", &eks.AccessPolicyAssociationArgs{
+		ClusterName:  cluster.Name,
+		PolicyArn:    pulumi.String("arn:aws:eks::aws:cluster-access-policy/AmazonEKSEditPolicy"),
+		PrincipalArn: role.Arn,
+		AccessScope: &eks.AccessPolicyAssociationAccessScopeArgs{
+			Type:       pulumi.String("namespace"),
+			Namespaces: pulumi.ToStringArray(args.Namespaces),
+		},
+	}, childOptions(component, pulumi.DependsOn([]pulumi.Resource{
+		accessEntry,
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	// In nudge mode, the SecretManagers reading a secret may be in any
+	// namespace
+	if args.Mode == "nudge" {
+		err = newSyncLambdaRBAC(ctx, component, args.Provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Secrets Manager events are delivered through CloudTrail, which needs a
+	// trail logging management events in the account
+	tmpJSON2, err := json.Marshal(map[string]any{
+		"source": []string{"aws.secretsmanager"},
+		"detail-type": []string{
+			"AWS API Call via CloudTrail",
+			"AWS Service Event via CloudTrail",
+		},
+		"detail": map[string]any{
+			"eventSource": []string{"secretsmanager.amazonaws.com"},
+			"eventName":   syncEvents,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	eventsRule, err := cloudwatch.NewEventRule(ctx, "sync-lambda-events", &cloudwatch.EventRuleArgs{
+		Description:  pulumi.String("Secrets Manager changes synced into EKS"),
+		EventPattern: pulumi.String(string(tmpJSON2)),
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The schedule triggers a full resync, repairing lost events
+	resyncRule, err := cloudwatch.NewEventRule(ctx, "sync-lambda-resync", &cloudwatch.EventRuleArgs{
+		Description:        pulumi.String("Full resync of Secrets Manager secrets into EKS"),
+		ScheduleExpression: pulumi.String(args.ResyncSchedule),
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trigger := range []struct {
+		name string
+		rule *cloudwatch.EventRule
+	}{
+		{"sync-lambda-events", eventsRule},
+		{"sync-lambda-resync", resyncRule},
+	} {
+		_, err = cloudwatch.NewEventTarget(ctx, trigger.name, &cloudwatch.EventTargetArgs{
+			Rule: trigger.rule.Name,
+			Arn:  function.Arn,
+		}, childOptions(component)...)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = lambda.NewPermission(ctx, trigger.name, &lambda.PermissionArgs{
+			Action:    pulumi.String("lambda:InvokeFunction"),
+			Function:  function.Name,
+			Principal: pulumi.String("events.amazonaws.com"),
+			SourceArn: trigger.rule.Arn,
+		}, childOptions(component)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	component.Role, component.Function = role, function
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"roleArn":     role.Arn,
+		"functionArn": function.Arn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return component, nil
+}
+
+// newSyncLambdaRBAC allows the group of the Lambda to list and patch the
+// SecretManagers of the cluster
+func newSyncLambdaRBAC(ctx *pulumi.Context, component *SyncLambdaComponent, provider *kubernetes.Provider) error {
+	if provider == nil {
+		return fmt.Errorf("the sync Lambda needs a Kubernetes provider in nudge mode")
+	}
+	opts := childOptions(component, pulumi.Provider(provider))
+
+	clusterRole, err := rbacv1.NewClusterRole(ctx, "sync-lambda-secretmanagers", &rbacv1.ClusterRoleArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name: pulumi.String(syncLambdaGroup),
+		},
+		Rules: rbacv1.PolicyRuleArray{
+			&rbacv1.PolicyRuleArgs{
+				ApiGroups: pulumi.StringArray{pulumi.String("my.domain")},
+				Resources: pulumi.StringArray{pulumi.String("secretmanagers")},
+				Verbs: pulumi.StringArray{
+					pulumi.String("get"),
+					pulumi.String("list"),
+					pulumi.String("patch"),
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = rbacv1.NewClusterRoleBinding(ctx, "sync-lambda-secretmanagers", &rbacv1.ClusterRoleBindingArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name: pulumi.String(syncLambdaGroup),
+		},
+		RoleRef: &rbacv1.RoleRefArgs{
+			ApiGroup: pulumi.String("rbac.authorization.k8s.io"),
+			Kind:     pulumi.String("ClusterRole"),
+			Name:     clusterRole.Metadata.Name().Elem(),
+		},
+		Subjects: rbacv1.SubjectArray{
+			&rbacv1.SubjectArgs{
+				ApiGroup: pulumi.String("rbac.authorization.k8s.io"),
+				Kind:     pulumi.String("Group"),
+				Name:     pulumi.String(syncLambdaGroup),
+			},
+		},
+	}, opts...)
+	return err
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestBuildSyncLambda(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross-compiles the Lambda")
+	}
+
+	code, err := buildSyncLambda("../cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrap, ok := code.Assets()["bootstrap"].(pulumi.Asset)
+	if !ok {
+		t.Fatalf("assets = %v, want a bootstrap file", code.Assets())
+	}
+	binary, err := elf.Open(bootstrap.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer binary.Close()
+	if binary.Machine != elf.EM_AARCH64 {
+		t.Errorf("bootstrap is built for %s, want arm64", binary.Machine)
+	}
+}
+
+func TestSyncLambda(t *testing.T) {
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		cluster, err := newTestCluster(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = NewSyncLambdaComponent(ctx, "sync-lambda", &SyncLambdaComponentArgs{
+			Cluster:   cluster,
+			Region:    "us-east-1",
+			AccountID: "111111111111",
+			Code: pulumi.NewAssetArchive(map[string]any{
+				"bootstrap": pulumi.NewStringAsset("#!/bin/sh"),
+			}),
+			SecretPrefix:   "eks-sync-",
+			Namespaces:     []string{"apps", "jobs"},
+			ResyncSchedule: "rate(1 hour)",
+			Mode:           "write",
+		})
+		return err
+	})
+
+	t.Run("function", func(t *testing.T) {
+		function := m.inputs(t, "aws:lambda/function:Function", "sync-lambda")
+		if runtime := function["runtime"].StringValue(); runtime != "provided.al2023" {
+			t.Errorf("runtime = %q, want provided.al2023", runtime)
+		}
+		if architectures := stringsOf(function["architectures"]); !slices.Equal(architectures, []string{"arm64"}) {
+			t.Errorf("architectures = %v, want [arm64]", architectures)
+		}
+		variables := function["environment"].ObjectValue()["variables"].ObjectValue()
+		for key, want := range map[string]string{
+			"EKS_CLUSTER_NAMES":  "test-eks",
+			"SECRET_PREFIX":      "eks-sync-",
+			"K8S_NAMESPACE":      "apps",
+			"ALLOWED_NAMESPACES": "apps,jobs",
+			"SYNC_MODE":          "write",
+		} {
+			if got := variables[resource.PropertyKey(key)].StringValue(); got != want {
+				t.Errorf("%s = %q, want %q", key, got, want)
+			}
+		}
+	})
+
+	t.Run("least privilege policy", func(t *testing.T) {
+		var policy struct {
+			Statement []struct {
+				Action   any
+				Resource string
+			}
+		}
+		document := m.inputs(t, "aws:iam/rolePolicy:RolePolicy", "sync-lambda-policy")["policy"].StringValue()
+		if err := json.Unmarshal([]byte(document), &policy); err != nil {
+			t.Fatal(err)
+		}
+		var resources []string
+		for _, statement := range policy.Statement {
+			resources = append(resources, statement.Resource)
+		}
+		want := []string{
+			"arn:aws:secretsmanager:us-east-1:111111111111:secret:eks-sync-*",
+			"*",
+			"arn:aws:mock::111111111111:test-eks",
+		}
+		if !slices.Equal(resources, want) {
+			t.Errorf("policy resources = %v, want %v", resources, want)
+		}
+	})
+
+	t.Run("cluster access scoped to the namespaces", func(t *testing.T) {
+		association := m.inputs(t, "aws:eks/accessPolicyAssociation:AccessPolicyAssociation", "sync-lambda-access-policy")
+		scope := association["accessScope"].ObjectValue()
+		if scopeType := scope["type"].StringValue(); scopeType != "namespace" {
+			t.Errorf("access scope type = %q, want namespace", scopeType)
+		}
+		if namespaces := stringsOf(scope["namespaces"]); !slices.Equal(namespaces, []string{"apps", "jobs"}) {
+			t.Errorf("access scope namespaces = %v, want [apps jobs]", namespaces)
+		}
+		if n := m.count("kubernetes:rbac.authorization.k8s.io/v1:ClusterRole"); n != 0 {
+			t.Errorf("%d cluster roles, want none in write mode", n)
+		}
+	})
+
+	t.Run("triggers", func(t *testing.T) {
+		var pattern struct {
+			Detail struct {
+				EventName []string `json:"eventName"`
+			} `json:"detail"`
+		}
+		rule := m.inputs(t, "aws:cloudwatch/eventRule:EventRule", "sync-lambda-events")
+		if err := json.Unmarshal([]byte(rule["eventPattern"].StringValue()), &pattern); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(pattern.Detail.EventName, syncEvents) {
+			t.Errorf("event names = %v, want %v", pattern.Detail.EventName, syncEvents)
+		}
+
+		resync := m.inputs(t, "aws:cloudwatch/eventRule:EventRule", "sync-lambda-resync")
+		if schedule := resync["scheduleExpression"].StringValue(); schedule != "rate(1 hour)" {
+			t.Errorf("resync schedule = %q, want rate(1 hour)", schedule)
+		}
+
+		if n := m.count("aws:cloudwatch/eventTarget:EventTarget"); n != 2 {
+			t.Errorf("%d event targets, want 2", n)
+		}
+		if n := m.count("aws:lambda/permission:Permission"); n != 2 {
+			t.Errorf("%d Lambda permissions, want 2", n)
+		}
+	})
+}
+
+func TestSyncLambdaNudge(t *testing.T) {
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		cluster, err := newTestCluster(ctx)
+		if err != nil {
+			return err
+		}
+		provider, err := kubernetes.NewProvider(ctx, "cluster", &kubernetes.ProviderArgs{})
+		if err != nil {
+			return err
+		}
+
+		_, err = NewSyncLambdaComponent(ctx, "sync-lambda", &SyncLambdaComponentArgs{
+			Cluster:   cluster,
+			Region:    "us-east-1",
+			AccountID: "111111111111",
+			Code: pulumi.NewAssetArchive(map[string]any{
+				"bootstrap": pulumi.NewStringAsset("#!/bin/sh"),
+			}),
+			SecretPrefix:   "eks-sync-",
+			Namespaces:     []string{"apps"},
+			ResyncSchedule: "rate(1 hour)",
+			Mode:           "nudge",
+			Provider:       provider,
+		})
+		return err
+	})
+
+	variables := m.inputs(t, "aws:lambda/function:Function", "sync-lambda")["environment"].ObjectValue()["variables"].ObjectValue()
+	if mode := variables["SYNC_MODE"].StringValue(); mode != "nudge" {
+		t.Errorf("SYNC_MODE = %q, want nudge", mode)
+	}
+
+	entry := m.inputs(t, "aws:eks/accessEntry:AccessEntry", "sync-lambda-access-entry")
+	if groups := stringsOf(entry["kubernetesGroups"]); !slices.Equal(groups, []string{syncLambdaGroup}) {
+		t.Errorf("access entry groups = %v, want [%s]", groups, syncLambdaGroup)
+	}
+
+	role := m.inputs(t, "kubernetes:rbac.authorization.k8s.io/v1:ClusterRole", "sync-lambda-secretmanagers")
+	rules := role["rules"].ArrayValue()
+	if len(rules) != 1 {
+		t.Fatalf("%d rules, want 1", len(rules))
+	}
+	rule := rules[0].ObjectValue()
+	if resources := stringsOf(rule["resources"]); !slices.Equal(resources, []string{"secretmanagers"}) {
+		t.Errorf("resources = %v, want [secretmanagers]", resources)
+	}
+	if verbs := stringsOf(rule["verbs"]); !slices.Equal(verbs, []string{"get", "list", "patch"}) {
+		t.Errorf("verbs = %v, want get, list and patch", verbs)
+	}
+
+	binding := m.inputs(t, "kubernetes:rbac.authorization.k8s.io/v1:ClusterRoleBinding", "sync-lambda-secretmanagers")
+	subject := binding["subjects"].ArrayValue()[0].ObjectValue()
+	if subject["kind"].StringValue() != "Group" || subject["name"].StringValue() != syncLambdaGroup {
+		t.Errorf("subject = %v, want the group of the Lambda", subject)
+	}
+	if name := binding["roleRef"].ObjectValue()["name"].StringValue(); name != syncLambdaGroup {
+		t.Errorf("role = %q, want %s", name, syncLambdaGroup)
+	}
+}
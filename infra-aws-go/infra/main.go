@@ -1,184 +1,144 @@
 package main
 
 import (
-	"encoding/json"
+	"fmt"
 
-	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
-	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/eks"
-	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
 func main() {
 	pulumi.Run(func(ctx *pulumi.Context) error {
-		tmpJSON0, err := json.Marshal(map[string]any{
-			"Version": "2012-10-17",
-			"Statement": []map[string]any{
-				{
-					"Action": []string{
-						"sts:AssumeRole",
-						"sts:TagSession",
-					},
-					"Effect": "Allow",
-					"Principal": map[string]any{
-						"Service": "eks.amazonaws.com",
-					},
-				},
-			},
-		})
+		cfg, err := loadStackConfig(ctx)
 		if err != nil {
 			return err
 		}
 
-		json0 := string(tmpJSON0)
-		cluster, err := iam.NewRole(ctx, "cluster-role", &iam.RoleArgs{
-			Name:             pulumi.String("eksClusterRole"),
-			AssumeRolePolicy: pulumi.String(json0),
-		})
+		network, err := newNetwork(ctx, cfg)
 		if err != nil {
 			return err
 		}
 
-		clusterAmazonEKSClusterPolicy, err := iam.NewRolePolicyAttachment(
-			ctx,
-			"cluster-AmazonEKSClusterPolicy",
-			&iam.RolePolicyAttachmentArgs{
-				PolicyArn: pulumi.String("arn:aws:iam::aws:policy/AmazonEKSClusterPolicy"),
-				Role:      cluster.Name,
-			},
-		)
+		secretsKey, err := newSecretsKey(ctx, cfg.ClusterName)
 		if err != nil {
 			return err
 		}
 
-		t := true
-		vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
-			Default: &t,
+		cluster, err := NewClusterComponent(ctx, "cluster", &ClusterComponentArgs{
+			Name:             cfg.ClusterName,
+			Version:          cfg.KubernetesVersion,
+			RoleName:         cfg.ClusterRoleName,
+			Region:           cfg.Region,
+			SubnetIds:        network.SubnetIds,
+			EncryptionKeyArn: secretsKey.Arn,
 		})
 		if err != nil {
 			return err
 		}
 
-		subnetIds, err := ec2.GetSubnets(ctx, &ec2.GetSubnetsArgs{
-			Filters: []ec2.GetSubnetsFilter{
-				{
-					Name:   "vpc-id",
-					Values: []string{vpc.Id},
-				},
-				{
-					Name: "availability-zone",
-					Values: []string{
-						"us-east-1a",
-						"us-east-1b",
-					},
-				},
-			},
+		nodes, err := NewNodesComponent(ctx, "nodes", &NodesComponentArgs{
+			Cluster:   cluster,
+			RoleName:  cfg.NodeRoleName,
+			VpcId:     network.VpcId,
+			SubnetIds: network.SubnetIds,
+			Config:    cfg.Nodes,
+		})
+		if err != nil {
+			return err
+		}
+
+		identity, err := aws.GetCallerIdentity(ctx, &aws.GetCallerIdentityArgs{})
+		if err != nil {
+			return err
+		}
+
+		secretArnPrefix := cfg.Operator.SecretArnPrefix
+		if secretArnPrefix == "" {
+			secretArnPrefix = fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s", cfg.Region, identity.AccountId, cfg.SyncLambda.SecretPrefix)
+		}
+
+		operator, err := newOperatorRole(ctx, &operatorRoleArgs{
+			Cluster:         cluster,
+			Namespace:       cfg.Operator.Namespace,
+			ServiceAccount:  cfg.Operator.ServiceAccount,
+			SecretArnPrefix: secretArnPrefix,
 		})
 		if err != nil {
 			return err
 		}
 
-		eksCluster, err := eks.NewCluster(ctx, "demo-eks", &eks.ClusterArgs{
-			Name: pulumi.String("demo-eks"),
-			AccessConfig: &eks.ClusterAccessConfigArgs{
-				AuthenticationMode: pulumi.String("API"),
-			},
-			RoleArn: cluster.Arn,
-			Version: pulumi.String("1.33"),
-			VpcConfig: &eks.ClusterVpcConfigArgs{
-				SubnetIds: pulumi.ToStringArray(subnetIds.Ids),
-			},
-		}, pulumi.DependsOn([]pulumi.Resource{
-			clusterAmazonEKSClusterPolicy,
-		}))
+		syncLambdaCode, err := buildSyncLambda(cfg.SyncLambda.Source)
 		if err != nil {
 			return err
 		}
 
-		tmpJSON1, err := json.Marshal(map[string]any{
-			"Version": "2012-10-17",
-			"Statement": []map[string]any{
-				{
-					"Action": []string{
-						"sts:AssumeRole",
-						"sts:TagSession",
-					},
-					"Effect": "Allow",
-					"Principal": map[string]any{
-						"Service": "ec2.amazonaws.com",
-					},
-				},
-			},
+		// Kubernetes resources are only managed when the operator is deployed
+		// or nudged by the Lambda
+		var provider *kubernetes.Provider
+		if cfg.Operator.Image != "" || cfg.SyncLambda.Mode == "nudge" {
+			provider, err = kubernetes.NewProvider(ctx, "cluster", &kubernetes.ProviderArgs{
+				Kubeconfig: cluster.Kubeconfig,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		syncLambda, err := NewSyncLambdaComponent(ctx, "sync-lambda", &SyncLambdaComponentArgs{
+			Cluster:        cluster,
+			Region:         cfg.Region,
+			AccountID:      identity.AccountId,
+			Code:           syncLambdaCode,
+			SecretPrefix:   cfg.SyncLambda.SecretPrefix,
+			Namespaces:     cfg.SyncLambda.Namespaces,
+			ResyncSchedule: cfg.SyncLambda.ResyncSchedule,
+			Mode:           cfg.SyncLambda.Mode,
+			Provider:       provider,
 		})
 		if err != nil {
 			return err
 		}
 
-		json1 := string(tmpJSON1)
-		nodeRole, err := iam.NewRole(ctx, "node-role", &iam.RoleArgs{
-			Name:             pulumi.String("nodeRole"),
-			AssumeRolePolicy: pulumi.String(json1),
-			ManagedPolicyArns: pulumi.StringArray{
-				pulumi.String("arn:aws:iam::aws:policy/AmazonEKSWorkerNodePolicy"),
-				pulumi.String("arn:aws:iam::aws:policy/AmazonEKS_CNI_Policy"),
-				pulumi.String("arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"),
-				pulumi.String("arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"),
-			},
+		_, err = newSecretsKeyPolicy(ctx, &secretsKeyPolicyArgs{
+			Key:        secretsKey,
+			Region:     cfg.Region,
+			AccountID:  identity.AccountId,
+			Decrypters: []pulumi.StringInput{operator.Role.Arn, syncLambda.Role.Arn},
 		})
 		if err != nil {
 			return err
 		}
 
-		// nodeInstanceProfile, err := iam.NewInstanceProfile(
-		_, err = iam.NewInstanceProfile(
-			ctx,
-			"node-instance-profile",
-			&iam.InstanceProfileArgs{
-				Role: nodeRole.Name,
-			},
-		)
-
-		// nodeSecurityGroup, err := ec2.NewSecurityGroup(
-		_, err = ec2.NewSecurityGroup(
-			ctx,
-			"node-security-group",
-			&ec2.SecurityGroupArgs{
-				Description: pulumi.String("Security group for all nodes in the cluster"),
-				VpcId:       pulumi.StringPtr(vpc.Id),
-				Tags: pulumi.StringMap{
-					"kubernetes.io/cluster/demo-eks": pulumi.String("owned"),
-				},
-				Ingress: ec2.SecurityGroupIngressArray{
-					ec2.SecurityGroupIngressArgs{
-						Description: pulumi.StringPtr("Allow node to communicate with each other"),
-						FromPort:    pulumi.Int(0),
-						ToPort:      pulumi.Int(0),
-						Protocol:    pulumi.String("-1"),
-						Self:        pulumi.BoolPtr(true),
-					},
-					ec2.SecurityGroupIngressArgs{
-						Description: pulumi.StringPtr(
-							"Allow worker Kubelets and pods to receive communication from the cluster control plane",
-						),
-						FromPort:       pulumi.Int(1025),
-						Protocol:       pulumi.String("tcp"),
-						ToPort:         pulumi.Int(65535),
-						SecurityGroups: eksCluster.VpcConfig.SecurityGroupIds(),
-					},
-					ec2.SecurityGroupIngressArgs{
-						Description: pulumi.StringPtr(
-							"Allow pods running extension API servers on port 443 to receive communication from cluster control plane",
-						),
-						FromPort:       pulumi.Int(443),
-						ToPort:         pulumi.Int(443),
-						SecurityGroups: eksCluster.VpcConfig.SecurityGroupIds(),
-						Protocol:       pulumi.String("tcp"),
-					},
-				},
-			},
-		)
-
-		// _, err = ec2.NewSecurityGroupRule(ctx, "cluster-sg-rule-1", &ec2.SecurityGroupRuleArgs{})
+		err = newManagedSecrets(ctx, secretsKey, cfg.SyncLambda.SecretPrefix, cfg.Secrets)
+		if err != nil {
+			return err
+		}
+
+		ctx.Export("kubeconfig", cluster.Kubeconfig)
+		ctx.Export("clusterEndpoint", cluster.Endpoint)
+		ctx.Export("oidcIssuer", cluster.OidcIssuer)
+		ctx.Export("nodeRoleArn", nodes.Role.Arn)
+		ctx.Export("syncLambdaArn", syncLambda.Function.Arn)
+		ctx.Export("operatorRoleArn", operator.Role.Arn)
+		ctx.Export("secretsKeyArn", secretsKey.Arn)
+
+		if cfg.Operator.Image != "" {
+			err = newOperator(ctx, &operatorArgs{
+				Provider:       provider,
+				Manifests:      cfg.Operator.Manifests,
+				Namespace:      cfg.Operator.Namespace,
+				ServiceAccount: cfg.Operator.ServiceAccount,
+				Image:          cfg.Operator.Image,
+				Region:         cfg.Region,
+				RoleArn:        operator.Role.Arn,
+				Samples:        cfg.Operator.Samples,
+			}, pulumi.DependsOn([]pulumi.Resource{nodes}))
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"gopkg.in/yaml.v3"
+)
+
+// mocks records the resources a program registers, and answers its invokes
+type mocks struct {
+	mu        sync.Mutex
+	resources map[string]pulumi.MockResourceArgs
+}
+
+// NewResource returns the inputs of a resource as its state, with an ARN and
+// a name for resources whose inputs have none, and the outputs AWS computes
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[args.TypeToken+"::"+args.Name] = args
+
+	state := args.Inputs.Copy()
+	if _, ok := state["arn"]; !ok {
+		state["arn"] = resource.NewStringProperty("arn:aws:mock::111111111111:" + args.Name)
+	}
+	if _, ok := state["name"]; !ok {
+		state["name"] = resource.NewStringProperty(args.Name)
+	}
+
+	// Outputs computed by AWS that the program reads
+	switch args.TypeToken {
+	case "aws:eks/cluster:Cluster":
+		vpcConfig := state["vpcConfig"].ObjectValue().Copy()
+		vpcConfig["clusterSecurityGroupId"] = resource.NewStringProperty("sg-cluster")
+		state["vpcConfig"] = resource.NewObjectProperty(vpcConfig)
+		state["endpoint"] = resource.NewStringProperty("https://" + args.Name + ".eks.example.com")
+		state["certificateAuthority"] = resource.NewObjectProperty(resource.PropertyMap{
+			"data": resource.NewStringProperty("Y2VydGlmaWNhdGU="),
+		})
+		state["identities"] = resource.NewArrayProperty([]resource.PropertyValue{
+			resource.NewObjectProperty(resource.PropertyMap{
+				"oidcs": resource.NewArrayProperty([]resource.PropertyValue{
+					resource.NewObjectProperty(resource.PropertyMap{
+						"issuer": resource.NewStringProperty("https://oidc.eks.us-east-1.amazonaws.com/id/" + args.Name),
+					}),
+				}),
+			}),
+		})
+	case "aws:ec2/launchTemplate:LaunchTemplate":
+		state["latestVersion"] = resource.NewNumberProperty(1)
+	}
+	return args.Name + "-id", state, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	switch args.Token {
+	case "aws:index/getCallerIdentity:getCallerIdentity":
+		return resource.PropertyMap{
+			"accountId": resource.NewStringProperty("111111111111"),
+			"arn":       resource.NewStringProperty("arn:aws:iam::111111111111:user/test"),
+			"userId":    resource.NewStringProperty("test"),
+		}, nil
+	case "aws:ec2/getVpc:getVpc":
+		return resource.PropertyMap{"id": resource.NewStringProperty("vpc-1")}, nil
+	case "aws:ec2/getSubnets:getSubnets":
+		return resource.PropertyMap{"ids": resource.NewArrayProperty([]resource.PropertyValue{
+			resource.NewStringProperty("subnet-a"),
+			resource.NewStringProperty("subnet-b"),
+		})}, nil
+	case "kubernetes:kustomize:directory":
+		objects, err := kustomizeResources(args.Args["directory"].StringValue())
+		if err != nil {
+			return nil, err
+		}
+		return resource.NewPropertyMapFromMap(map[string]any{"result": objects}), nil
+	}
+	return args.Args, nil
+}
+
+// inputs returns the inputs of the resource of type typeToken named name
+func (m *mocks) inputs(t *testing.T, typeToken, name string) resource.PropertyMap {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args, ok := m.resources[typeToken+"::"+name]
+	if !ok {
+		t.Fatalf("no %s named %s was registered", typeToken, name)
+	}
+	return args.Inputs
+}
+
+// count returns how many resources of type typeToken were registered
+func (m *mocks) count(typeToken string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, args := range m.resources {
+		if args.TypeToken == typeToken {
+			n++
+		}
+	}
+	return n
+}
+
+// runWithMocks runs program against mocks, failing the test on errors
+func runWithMocks(t *testing.T, program pulumi.RunFunc) *mocks {
+	t.Helper()
+	m := &mocks{resources: map[string]pulumi.MockResourceArgs{}}
+	if err := pulumi.RunErr(program, pulumi.WithMocks("infra", "test", m)); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// stringsOf returns the strings in an array property
+func stringsOf(value resource.PropertyValue) []string {
+	var values []string
+	for _, element := range value.ArrayValue() {
+		values = append(values, element.StringValue())
+	}
+	return values
+}
+
+// kustomizeResources decodes the resources of the kustomization in
+// directory, without applying its patches
+func kustomizeResources(directory string) ([]any, error) {
+	var kustomization struct {
+		Resources []string `yaml:"resources"`
+	}
+	content, err := os.ReadFile(filepath.Join(directory, "kustomization.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, &kustomization); err != nil {
+		return nil, err
+	}
+
+	var objects []any
+	for _, file := range kustomization.Resources {
+		content, err := os.ReadFile(filepath.Join(directory, file))
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var object map[string]any
+			if err := decoder.Decode(&object); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// newTestCluster creates the test-eks cluster in subnet-a
+func newTestCluster(ctx *pulumi.Context) (*ClusterComponent, error) {
+	return NewClusterComponent(ctx, "cluster", &ClusterComponentArgs{
+		Name:      "test-eks",
+		Version:   "1.33",
+		RoleName:  "eksClusterRole",
+		Region:    "us-east-1",
+		SubnetIds: pulumi.ToStringArray([]string{"subnet-a"}),
+	})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/eks"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// nodeTaint is a Kubernetes taint put on every node of the group
+type nodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// nodeGroupConfig is the shape of the nodes, read from the "nodes" stack
+// config
+type nodeGroupConfig struct {
+	InstanceTypes []string          `json:"instanceTypes"`
+	CapacityType  string            `json:"capacityType"`
+	MinSize       int               `json:"minSize"`
+	MaxSize       int               `json:"maxSize"`
+	DesiredSize   int               `json:"desiredSize"`
+	DiskSize      int               `json:"diskSize"`
+	Labels        map[string]string `json:"labels"`
+	Taints        []nodeTaint       `json:"taints"`
+}
+
+// defaultNodeGroupConfig is a small on-demand group, enough to run the operator
+func defaultNodeGroupConfig() nodeGroupConfig {
+	return nodeGroupConfig{
+		InstanceTypes: []string{"t3.medium"},
+		CapacityType:  "ON_DEMAND",
+		MinSize:       1,
+		MaxSize:       3,
+		DesiredSize:   2,
+		DiskSize:      20,
+	}
+}
+
+// validate checks the config against what EKS accepts
+func (c nodeGroupConfig) validate() error {
+	if len(c.InstanceTypes) == 0 {
+		return fmt.Errorf("nodes: at least one instance type is required")
+	}
+	if c.CapacityType != "ON_DEMAND" && c.CapacityType != "SPOT" {
+		return fmt.Errorf("nodes: capacityType must be ON_DEMAND or SPOT, got %q", c.CapacityType)
+	}
+	if c.MinSize < 0 || c.MaxSize < 1 || c.MinSize > c.MaxSize {
+		return fmt.Errorf("nodes: invalid scaling bounds %d..%d", c.MinSize, c.MaxSize)
+	}
+	if c.DesiredSize < c.MinSize || c.DesiredSize > c.MaxSize {
+		return fmt.Errorf("nodes: desiredSize %d is outside %d..%d", c.DesiredSize, c.MinSize, c.MaxSize)
+	}
+	if c.DiskSize < 1 {
+		return fmt.Errorf("nodes: diskSize must be positive, got %d", c.DiskSize)
+	}
+	for _, taint := range c.Taints {
+		if taint.Key == "" {
+			return fmt.Errorf("nodes: taint without a key")
+		}
+		if !slices.Contains([]string{"NO_SCHEDULE", "NO_EXECUTE", "PREFER_NO_SCHEDULE"}, taint.Effect) {
+			return fmt.Errorf("nodes: taint %s has invalid effect %q", taint.Key, taint.Effect)
+		}
+	}
+	return nil
+}
+
+// NodesComponentArgs wires the nodes to the cluster
+type NodesComponentArgs struct {
+	Cluster   *ClusterComponent
+	RoleName  string
+	VpcId     pulumi.StringPtrInput
+	SubnetIds pulumi.StringArrayInput
+	Config    nodeGroupConfig
+}
+
+// NodesComponent is the managed node group of the cluster, with the role and
+// the security group of its nodes
+type NodesComponent struct {
+	pulumi.ResourceState
+
+	Role            *iam.Role
+	InstanceProfile *iam.InstanceProfile
+	SecurityGroup   *ec2.SecurityGroup
+	LaunchTemplate  *ec2.LaunchTemplate
+	NodeGroup       *eks.NodeGroup
+}
+
+// NewNodesComponent creates a managed node group whose nodes run as the node
+// role in the node security group, through a launch template
+func NewNodesComponent(ctx *pulumi.Context, name string, args *NodesComponentArgs, opts ...pulumi.ResourceOption) (*NodesComponent, error) {
+	component := &NodesComponent{}
+	err := ctx.RegisterComponentResource("infra:index:NodesComponent", name, component, opts...)
+	if err != nil {
+		return nil, err
+	}
+	cluster := args.Cluster.Cluster
+
+	tmpJSON0, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Action": []string{
+					"sts:AssumeRole",
+					"sts:TagSession",
+				},
+				"Effect": "Allow",
+				"Principal": map[string]any{
+					"Service": "ec2.amazonaws.com",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	component.Role, err = iam.NewRole(ctx, "node-role", &iam.RoleArgs{
+		Name:             pulumi.String(args.RoleName),
+		AssumeRolePolicy: pulumi.String(string(tmpJSON0)),
+		ManagedPolicyArns: pulumi.StringArray{
+			pulumi.String("arn:aws:iam::aws:policy/AmazonEKSWorkerNodePolicy"),
+			pulumi.String("arn:aws:iam::aws:policy/AmazonEKS_CNI_Policy"),
+			pulumi.String("arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"),
+			pulumi.String("arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"),
+		},
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	component.InstanceProfile, err = iam.NewInstanceProfile(ctx, "node-instance-profile", &iam.InstanceProfileArgs{
+		Role: component.Role.Name,
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	component.SecurityGroup, err = ec2.NewSecurityGroup(ctx, "node-security-group", &ec2.SecurityGroupArgs{
+		Description: pulumi.String("Security group for all nodes in the cluster"),
+		VpcId:       args.VpcId,
+		Tags: pulumi.StringMap{
+			"kubernetes.io/cluster/" + args.Cluster.Name: pulumi.String("owned"),
+		},
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				Description: pulumi.StringPtr("Allow node to communicate with each other"),
+				FromPort:    pulumi.Int(0),
+				ToPort:      pulumi.Int(0),
+				Protocol:    pulumi.String("-1"),
+				Self:        pulumi.BoolPtr(true),
+			},
+			ec2.SecurityGroupIngressArgs{
+				Description: pulumi.StringPtr(
+					"Allow worker Kubelets and pods to receive communication from the cluster control plane",
+				),
+				FromPort:       pulumi.Int(1025),
+				Protocol:       pulumi.String("tcp"),
+				ToPort:         pulumi.Int(65535),
+				SecurityGroups: cluster.VpcConfig.SecurityGroupIds(),
+			},
+			ec2.SecurityGroupIngressArgs{
+				Description: pulumi.StringPtr(
+					"Allow pods running extension API servers on port 443 to receive communication from cluster control plane",
+				),
+				FromPort:       pulumi.Int(443),
+				ToPort:         pulumi.Int(443),
+				SecurityGroups: cluster.VpcConfig.SecurityGroupIds(),
+				Protocol:       pulumi.String("tcp"),
+			},
+		},
+		Egress: ec2.SecurityGroupEgressArray{
+			ec2.SecurityGroupEgressArgs{
+				Description: pulumi.StringPtr("Allow nodes to reach the control plane, registries and AWS APIs"),
+				FromPort:    pulumi.Int(0),
+				ToPort:      pulumi.Int(0),
+				Protocol:    pulumi.String("-1"),
+				CidrBlocks:  pulumi.StringArray{pulumi.String("0.0.0.0/0")},
+			},
+		},
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes join both the node security group and the cluster security group,
+	// which lets them reach the control plane and pods on other nodes
+	component.LaunchTemplate, err = ec2.NewLaunchTemplate(ctx, "node-launch-template", &ec2.LaunchTemplateArgs{
+		Description: pulumi.String("Nodes of the EKS cluster"),
+		VpcSecurityGroupIds: pulumi.StringArray{
+			component.SecurityGroup.ID(),
+			cluster.VpcConfig.ClusterSecurityGroupId().Elem(),
+		},
+		BlockDeviceMappings: ec2.LaunchTemplateBlockDeviceMappingArray{
+			&ec2.LaunchTemplateBlockDeviceMappingArgs{
+				DeviceName: pulumi.String("/dev/xvda"),
+				Ebs: &ec2.LaunchTemplateBlockDeviceMappingEbsArgs{
+					VolumeSize: pulumi.Int(args.Config.DiskSize),
+					VolumeType: pulumi.String("gp3"),
+					Encrypted:  pulumi.String("true"),
+				},
+			},
+		},
+		// IMDSv2 only, with a hop limit letting pods reach it
+		MetadataOptions: &ec2.LaunchTemplateMetadataOptionsArgs{
+			HttpEndpoint:            pulumi.String("enabled"),
+			HttpTokens:              pulumi.String("required"),
+			HttpPutResponseHopLimit: pulumi.Int(2),
+		},
+	}, childOptions(component)...)
+	if err != nil {
+		return nil, err
+	}
+
+	taints := eks.NodeGroupTaintArray{}
+	for _, taint := range args.Config.Taints {
+		taints = append(taints, &eks.NodeGroupTaintArgs{
+			Key:    pulumi.String(taint.Key),
+			Value:  pulumi.StringPtr(taint.Value),
+			Effect: pulumi.String(taint.Effect),
+		})
+	}
+
+	component.NodeGroup, err = eks.NewNodeGroup(ctx, "node-group", &eks.NodeGroupArgs{
+		ClusterName:   cluster.Name,
+		NodeRoleArn:   component.Role.Arn,
+		SubnetIds:     args.SubnetIds,
+		InstanceTypes: pulumi.ToStringArray(args.Config.InstanceTypes),
+		CapacityType:  pulumi.String(args.Config.CapacityType),
+		ScalingConfig: &eks.NodeGroupScalingConfigArgs{
+			MinSize:     pulumi.Int(args.Config.MinSize),
+			MaxSize:     pulumi.Int(args.Config.MaxSize),
+			DesiredSize: pulumi.Int(args.Config.DesiredSize),
+		},
+		UpdateConfig: &eks.NodeGroupUpdateConfigArgs{
+			MaxUnavailable: pulumi.Int(1),
+		},
+		Labels: pulumi.ToStringMap(args.Config.Labels),
+		Taints: taints,
+		LaunchTemplate: &eks.NodeGroupLaunchTemplateArgs{
+			Id:      component.LaunchTemplate.ID(),
+			Version: pulumi.Sprintf("%d", component.LaunchTemplate.LatestVersion),
+		},
+	}, childOptions(component, pulumi.IgnoreChanges([]string{
+		// Left to the cluster autoscaler once created
+		"scalingConfig.desiredSize",
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"roleArn":   component.Role.Arn,
+		"nodeGroup": component.NodeGroup.Arn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return component, nil
+}
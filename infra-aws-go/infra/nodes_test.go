@@ -0,0 +1,154 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestNodeGroupConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*nodeGroupConfig)
+		err    string
+	}{
+		{"defaults", func(*nodeGroupConfig) {}, ""},
+		{"spot", func(c *nodeGroupConfig) { c.CapacityType = "SPOT" }, ""},
+		{"no instance types", func(c *nodeGroupConfig) { c.InstanceTypes = nil }, "instance type"},
+		{"unknown capacity type", func(c *nodeGroupConfig) { c.CapacityType = "RESERVED" }, "capacityType"},
+		{"min above max", func(c *nodeGroupConfig) { c.MinSize = 4 }, "scaling bounds"},
+		{"desired above max", func(c *nodeGroupConfig) { c.DesiredSize = 4 }, "desiredSize"},
+		{"taint without key", func(c *nodeGroupConfig) { c.Taints = []nodeTaint{{Effect: "NO_SCHEDULE"}} }, "without a key"},
+		{"taint effect", func(c *nodeGroupConfig) { c.Taints = []nodeTaint{{Key: "k", Effect: "NoSchedule"}} }, "invalid effect"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultNodeGroupConfig()
+			test.modify(&config)
+			err := config.validate()
+			if test.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("error = %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNodesComponent(t *testing.T) {
+	config := nodeGroupConfig{
+		InstanceTypes: []string{"m6i.large", "m5.large"},
+		CapacityType:  "SPOT",
+		MinSize:       2,
+		MaxSize:       5,
+		DesiredSize:   3,
+		DiskSize:      50,
+		Labels:        map[string]string{"workload": "operators"},
+		Taints:        []nodeTaint{{Key: "dedicated", Value: "operators", Effect: "NO_SCHEDULE"}},
+	}
+
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		cluster, err := newTestCluster(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = NewNodesComponent(ctx, "nodes", &NodesComponentArgs{
+			Cluster:   cluster,
+			RoleName:  "nodeRole",
+			VpcId:     pulumi.StringPtr("vpc-1"),
+			SubnetIds: pulumi.ToStringArray([]string{"subnet-a", "subnet-b"}),
+			Config:    config,
+		})
+		return err
+	})
+
+	t.Run("role", func(t *testing.T) {
+		role := m.inputs(t, "aws:iam/role:Role", "node-role")
+		if name := role["name"].StringValue(); name != "nodeRole" {
+			t.Errorf("role name = %q, want nodeRole", name)
+		}
+		policies := stringsOf(role["managedPolicyArns"])
+		if !slices.Contains(policies, "arn:aws:iam::aws:policy/AmazonEKSWorkerNodePolicy") {
+			t.Errorf("managed policies = %v, want the worker node policy", policies)
+		}
+		profile := m.inputs(t, "aws:iam/instanceProfile:InstanceProfile", "node-instance-profile")
+		if role := profile["role"].StringValue(); role != "nodeRole" {
+			t.Errorf("instance profile role = %q, want nodeRole", role)
+		}
+	})
+
+	t.Run("security group", func(t *testing.T) {
+		group := m.inputs(t, "aws:ec2/securityGroup:SecurityGroup", "node-security-group")
+		if vpc := group["vpcId"].StringValue(); vpc != "vpc-1" {
+			t.Errorf("vpc = %q, want vpc-1", vpc)
+		}
+		if owned := group["tags"].ObjectValue()["kubernetes.io/cluster/test-eks"].StringValue(); owned != "owned" {
+			t.Errorf("cluster tag = %q, want owned", owned)
+		}
+		if egress := group["egress"].ArrayValue(); len(egress) != 1 {
+			t.Errorf("%d egress rules, want 1", len(egress))
+		}
+	})
+
+	t.Run("launch template", func(t *testing.T) {
+		template := m.inputs(t, "aws:ec2/launchTemplate:LaunchTemplate", "node-launch-template")
+		securityGroups := stringsOf(template["vpcSecurityGroupIds"])
+		if !slices.Equal(securityGroups, []string{"node-security-group-id", "sg-cluster"}) {
+			t.Errorf("security groups = %v, want the node and cluster security groups", securityGroups)
+		}
+		if tokens := template["metadataOptions"].ObjectValue()["httpTokens"].StringValue(); tokens != "required" {
+			t.Errorf("httpTokens = %q, want required", tokens)
+		}
+		ebs := template["blockDeviceMappings"].ArrayValue()[0].ObjectValue()["ebs"].ObjectValue()
+		if size := ebs["volumeSize"].NumberValue(); size != 50 {
+			t.Errorf("volume size = %v, want 50", size)
+		}
+	})
+
+	t.Run("node group", func(t *testing.T) {
+		group := m.inputs(t, "aws:eks/nodeGroup:NodeGroup", "node-group")
+		if clusterName := group["clusterName"].StringValue(); clusterName != "test-eks" {
+			t.Errorf("cluster name = %q, want test-eks", clusterName)
+		}
+		if roleArn := group["nodeRoleArn"].StringValue(); roleArn != "arn:aws:mock::111111111111:node-role" {
+			t.Errorf("node role = %q, want the node role", roleArn)
+		}
+		if subnets := stringsOf(group["subnetIds"]); !slices.Equal(subnets, []string{"subnet-a", "subnet-b"}) {
+			t.Errorf("subnets = %v, want [subnet-a subnet-b]", subnets)
+		}
+		if types := stringsOf(group["instanceTypes"]); !slices.Equal(types, config.InstanceTypes) {
+			t.Errorf("instance types = %v, want %v", types, config.InstanceTypes)
+		}
+		if capacityType := group["capacityType"].StringValue(); capacityType != "SPOT" {
+			t.Errorf("capacity type = %q, want SPOT", capacityType)
+		}
+
+		scaling := group["scalingConfig"].ObjectValue()
+		if scaling["minSize"].NumberValue() != 2 || scaling["maxSize"].NumberValue() != 5 || scaling["desiredSize"].NumberValue() != 3 {
+			t.Errorf("scaling = %v, want 2..5 with 3 desired", scaling)
+		}
+
+		if workload := group["labels"].ObjectValue()["workload"].StringValue(); workload != "operators" {
+			t.Errorf("workload label = %q, want operators", workload)
+		}
+		taints := group["taints"].ArrayValue()
+		if len(taints) != 1 {
+			t.Fatalf("%d taints, want 1", len(taints))
+		}
+		taint := taints[0].ObjectValue()
+		if taint["key"].StringValue() != "dedicated" || taint["value"].StringValue() != "operators" || taint["effect"].StringValue() != "NO_SCHEDULE" {
+			t.Errorf("taint = %v, want dedicated=operators:NO_SCHEDULE", taint)
+		}
+
+		launchTemplate := group["launchTemplate"].ObjectValue()
+		if id := launchTemplate["id"].StringValue(); id != "node-launch-template-id" {
+			t.Errorf("launch template = %q, want node-launch-template-id", id)
+		}
+		if version := launchTemplate["version"].StringValue(); version != "1" {
+			t.Errorf("launch template version = %q, want 1", version)
+		}
+	})
+}
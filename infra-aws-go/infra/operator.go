@@ -0,0 +1,172 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
+	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/kustomize"
+	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// namePrefix is the prefix config/default gives the names of the operator
+// resources
+const namePrefix = "secret-manager-"
+
+// clusterScoped are the kinds of the operator resources without a namespace
+var clusterScoped = []string{"CustomResourceDefinition", "Namespace", "ClusterRole", "ClusterRoleBinding"}
+
+// operatorSample is a SecretManager created along with the operator
+type operatorSample struct {
+	Name      string         `json:"name"`
+	Namespace string         `json:"namespace"`
+	Spec      map[string]any `json:"spec"`
+}
+
+// operatorArgs configures the deployment of the operator into the cluster
+type operatorArgs struct {
+	Provider *kubernetes.Provider
+	// Manifests is the kustomize config directory of the operator
+	Manifests      string
+	Namespace      string
+	ServiceAccount string
+	Image          string
+	Region         string
+	// RoleArn is the IAM role of the service account
+	RoleArn pulumi.StringInput
+	Samples []operatorSample
+}
+
+// newOperator installs the CRDs, the RBAC and the manager of the operator
+// from its kustomize config, and the samples. The names and namespace are
+// the ones config/default gives them. Webhooks need certificates from
+// cert-manager and are left to make deploy, so only the storage version of
+// the API is served.
+func newOperator(ctx *pulumi.Context, args *operatorArgs, opts ...pulumi.ResourceOption) error {
+	opts = append(opts, pulumi.Provider(args.Provider))
+
+	namespace, err := corev1.NewNamespace(ctx, args.Namespace, &corev1.NamespaceArgs{
+		Metadata: &metav1.ObjectMetaArgs{
+			Name: pulumi.String(args.Namespace),
+			Labels: pulumi.StringMap{
+				"control-plane":          pulumi.String("controller-manager"),
+				"app.kubernetes.io/name": pulumi.String("secret-manager"),
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	crds, err := kustomize.NewDirectory(ctx, "operator-crd", kustomize.DirectoryArgs{
+		Directory:       pulumi.String(filepath.Join(args.Manifests, "crd")),
+		Transformations: []yaml.Transformation{args.transform},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	rbac, err := kustomize.NewDirectory(ctx, "operator-rbac", kustomize.DirectoryArgs{
+		Directory:       pulumi.String(filepath.Join(args.Manifests, "rbac")),
+		Transformations: []yaml.Transformation{args.transform},
+	}, append(opts, pulumi.DependsOn([]pulumi.Resource{namespace}))...)
+	if err != nil {
+		return err
+	}
+
+	manager, err := kustomize.NewDirectory(ctx, "operator-manager", kustomize.DirectoryArgs{
+		Directory:       pulumi.String(filepath.Join(args.Manifests, "manager")),
+		Transformations: []yaml.Transformation{args.transform},
+	}, append(opts, pulumi.DependsOn([]pulumi.Resource{crds, rbac}))...)
+	if err != nil {
+		return err
+	}
+
+	for _, sample := range args.Samples {
+		_, err = apiextensions.NewCustomResource(ctx, "secretmanager-"+sample.Namespace+"-"+sample.Name, &apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("my.domain/v2"),
+			Kind:       pulumi.String("SecretManager"),
+			Metadata: &metav1.ObjectMetaArgs{
+				Name:      pulumi.String(sample.Name),
+				Namespace: pulumi.String(sample.Namespace),
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": sample.Spec,
+			},
+		}, append(opts, pulumi.DependsOn([]pulumi.Resource{manager}))...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transform applies what config/default does to the resources of the
+// operator, and configures the manager
+func (args *operatorArgs) transform(obj map[string]any, _ ...pulumi.ResourceOption) {
+	metadata, _ := obj["metadata"].(map[string]any)
+	switch obj["kind"] {
+	case "CustomResourceDefinition":
+		// Without the conversion webhook, only the storage version is
+		// served, so nothing is stored without being converted
+		spec, _ := obj["spec"].(map[string]any)
+		spec["conversion"] = map[string]any{"strategy": "None"}
+		versions, _ := spec["versions"].([]any)
+		for _, version := range versions {
+			if version, ok := version.(map[string]any); ok {
+				version["served"] = version["storage"] == true
+			}
+		}
+		return
+	case "Namespace":
+		// Created by newOperator, before the RBAC
+		obj["apiVersion"], obj["kind"], obj["items"] = "v1", "List", []any{}
+		return
+	case "ServiceAccount":
+		annotations, _ := metadata["annotations"].(map[string]any)
+		if annotations == nil {
+			annotations = map[string]any{}
+		}
+		annotations["eks.amazonaws.com/role-arn"] = args.RoleArn
+		metadata["annotations"] = annotations
+	case "RoleBinding", "ClusterRoleBinding":
+		roleRef, _ := obj["roleRef"].(map[string]any)
+		roleRef["name"] = namePrefix + roleRef["name"].(string)
+		subjects, _ := obj["subjects"].([]any)
+		for _, subject := range subjects {
+			if subject, ok := subject.(map[string]any); ok && subject["kind"] == "ServiceAccount" {
+				subject["name"] = args.ServiceAccount
+				subject["namespace"] = args.Namespace
+			}
+		}
+	case "Deployment":
+		template, _ := obj["spec"].(map[string]any)["template"].(map[string]any)
+		podSpec, _ := template["spec"].(map[string]any)
+		podSpec["serviceAccountName"] = args.ServiceAccount
+		containers, _ := podSpec["containers"].([]any)
+		for _, container := range containers {
+			if container, ok := container.(map[string]any); ok && container["name"] == "manager" {
+				container["image"] = args.Image
+				env, _ := container["env"].([]any)
+				container["env"] = append(env,
+					map[string]any{"name": "ENABLE_WEBHOOKS", "value": "false"},
+					map[string]any{"name": "AWS_REGION", "value": args.Region},
+				)
+			}
+		}
+	}
+
+	if obj["kind"] == "ServiceAccount" {
+		metadata["name"] = args.ServiceAccount
+	} else {
+		metadata["name"] = namePrefix + metadata["name"].(string)
+	}
+	if !slices.Contains(clusterScoped, obj["kind"].(string)) {
+		metadata["namespace"] = args.Namespace
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestOperator(t *testing.T) {
+	m := runWithMocks(t, func(ctx *pulumi.Context) error {
+		role, err := iam.NewRole(ctx, "operator-role", &iam.RoleArgs{
+			AssumeRolePolicy: pulumi.String("{}"),
+		})
+		if err != nil {
+			return err
+		}
+		provider, err := kubernetes.NewProvider(ctx, "cluster", &kubernetes.ProviderArgs{})
+		if err != nil {
+			return err
+		}
+
+		return newOperator(ctx, &operatorArgs{
+			Provider:       provider,
+			Manifests:      "../../secret-manager/config",
+			Namespace:      "operators",
+			ServiceAccount: "secret-manager",
+			Image:          "registry.example.com/secret-manager:v1.2.3",
+			Region:         "us-east-1",
+			RoleArn:        role.Arn,
+			Samples: []operatorSample{{
+				Name:      "db",
+				Namespace: "apps",
+				Spec: map[string]any{
+					"target":  map[string]any{"name": "db"},
+					"sources": []any{map[string]any{"secretName": "eks-sync-db"}},
+				},
+			}},
+		})
+	})
+
+	t.Run("CRDs", func(t *testing.T) {
+		crd := m.inputs(t, "kubernetes:apiextensions.k8s.io/v1:CustomResourceDefinition", "secretmanagers.my.domain")
+		conversion := crd["spec"].ObjectValue()["conversion"].ObjectValue()
+		if strategy := conversion["strategy"].StringValue(); strategy != "None" {
+			t.Errorf("conversion strategy = %q, want None without webhooks", strategy)
+		}
+		served := map[string]bool{}
+		for _, version := range crd["spec"].ObjectValue()["versions"].ArrayValue() {
+			served[version.ObjectValue()["name"].StringValue()] = version.ObjectValue()["served"].BoolValue()
+		}
+		if !maps.Equal(served, map[string]bool{"v1": false, "v2": true}) {
+			t.Errorf("served versions = %v, want only v2 without the conversion webhook", served)
+		}
+	})
+
+	t.Run("namespace", func(t *testing.T) {
+		if n := m.count("kubernetes:core/v1:Namespace"); n != 1 {
+			t.Fatalf("%d namespaces, want 1", n)
+		}
+		m.inputs(t, "kubernetes:core/v1:Namespace", "operators")
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		account := m.inputs(t, "kubernetes:core/v1:ServiceAccount", "operators/secret-manager")
+		annotations := account["metadata"].ObjectValue()["annotations"].ObjectValue()
+		if roleArn := annotations["eks.amazonaws.com/role-arn"].StringValue(); roleArn != "arn:aws:mock::111111111111:operator-role" {
+			t.Errorf("role annotation = %q, want the operator role", roleArn)
+		}
+	})
+
+	t.Run("RBAC", func(t *testing.T) {
+		binding := m.inputs(t, "kubernetes:rbac.authorization.k8s.io/v1:ClusterRoleBinding", "secret-manager-manager-rolebinding")
+		if role := binding["roleRef"].ObjectValue()["name"].StringValue(); role != "secret-manager-manager-role" {
+			t.Errorf("role = %q, want secret-manager-manager-role", role)
+		}
+		subject := binding["subjects"].ArrayValue()[0].ObjectValue()
+		if subject["name"].StringValue() != "secret-manager" || subject["namespace"].StringValue() != "operators" {
+			t.Errorf("subject = %v, want the operator service account", subject)
+		}
+		m.inputs(t, "kubernetes:rbac.authorization.k8s.io/v1:ClusterRole", "secret-manager-manager-role")
+		m.inputs(t, "kubernetes:rbac.authorization.k8s.io/v1:Role", "operators/secret-manager-leader-election-role")
+	})
+
+	t.Run("manager", func(t *testing.T) {
+		deployment := m.inputs(t, "kubernetes:apps/v1:Deployment", "operators/secret-manager-controller-manager")
+		podSpec := deployment["spec"].ObjectValue()["template"].ObjectValue()["spec"].ObjectValue()
+		if account := podSpec["serviceAccountName"].StringValue(); account != "secret-manager" {
+			t.Errorf("service account = %q, want secret-manager", account)
+		}
+		container := podSpec["containers"].ArrayValue()[0].ObjectValue()
+		if image := container["image"].StringValue(); image != "registry.example.com/secret-manager:v1.2.3" {
+			t.Errorf("image = %q, want the configured image", image)
+		}
+		var env []string
+		for _, variable := range container["env"].ArrayValue() {
+			env = append(env, variable.ObjectValue()["name"].StringValue()+"="+variable.ObjectValue()["value"].StringValue())
+		}
+		if !slices.Equal(env, []string{"ENABLE_WEBHOOKS=false", "AWS_REGION=us-east-1"}) {
+			t.Errorf("env = %v, want webhooks disabled in us-east-1", env)
+		}
+	})
+
+	t.Run("samples", func(t *testing.T) {
+		sample := m.inputs(t, "kubernetes:my.domain/v2:SecretManager", "secretmanager-apps-db")
+		metadata := sample["metadata"].ObjectValue()
+		if metadata["name"].StringValue() != "db" || metadata["namespace"].StringValue() != "apps" {
+			t.Errorf("metadata = %v, want apps/db", metadata)
+		}
+		target := sample["spec"].ObjectValue()["target"].ObjectValue()
+		if target["name"] != resource.NewStringProperty("db") {
+			t.Errorf("target = %v, want db", target)
+		}
+	})
+}
+
+func TestOperatorTransformCRD(t *testing.T) {
+	crd := map[string]any{
+		"kind":     "CustomResourceDefinition",
+		"metadata": map[string]any{"name": "secretmanagers.my.domain"},
+		"spec": map[string]any{
+			"conversion": map[string]any{"strategy": "Webhook", "webhook": map[string]any{}},
+			"versions": []any{
+				map[string]any{"name": "v1", "served": true, "storage": false},
+				map[string]any{"name": "v2", "served": true, "storage": true},
+			},
+		},
+	}
+	(&operatorArgs{}).transform(crd)
+
+	spec := crd["spec"].(map[string]any)
+	if conversion := spec["conversion"]; !maps.Equal(conversion.(map[string]any), map[string]any{"strategy": "None"}) {
+		t.Errorf("conversion = %v, want None without the webhook", conversion)
+	}
+	want := map[string][2]bool{"v1": {false, false}, "v2": {true, true}}
+	for _, version := range spec["versions"].([]any) {
+		version := version.(map[string]any)
+		name := version["name"].(string)
+		if got := [2]bool{version["served"].(bool), version["storage"].(bool)}; got != want[name] {
+			t.Errorf("%s served, storage = %v, want %v", name, got, want[name])
+		}
+	}
+	if name := crd["metadata"].(map[string]any)["name"]; name != "secretmanagers.my.domain" {
+		t.Errorf("name = %v, want the CRD name unprefixed", name)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// subnetBits splits the VPC CIDR block into 16 subnets
+const subnetBits = 4
+
+// network is where the cluster and its nodes run
+type network struct {
+	VpcId     pulumi.StringPtrInput
+	SubnetIds pulumi.StringArrayInput
+}
+
+// newNetwork returns the network of the cluster, either the subnets of the
+// default VPC in the availability zones, or a dedicated VPC
+func newNetwork(ctx *pulumi.Context, cfg *stackConfig) (*network, error) {
+	if cfg.Vpc.Create {
+		return newDedicatedVpc(ctx, cfg)
+	}
+
+	t := true
+	vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
+		Default: &t,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	subnetIds, err := ec2.GetSubnets(ctx, &ec2.GetSubnetsArgs{
+		Filters: []ec2.GetSubnetsFilter{
+			{
+				Name:   "vpc-id",
+				Values: []string{vpc.Id},
+			},
+			{
+				Name:   "availability-zone",
+				Values: cfg.AvailabilityZones,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &network{
+		VpcId:     pulumi.StringPtr(vpc.Id),
+		SubnetIds: pulumi.ToStringArray(subnetIds.Ids),
+	}, nil
+}
+
+// newDedicatedVpc creates a VPC with a public and a private subnet per
+// availability zone. The cluster and its nodes run in the private subnets,
+// reaching the internet through NAT gateways in the public ones.
+func newDedicatedVpc(ctx *pulumi.Context, cfg *stackConfig) (*network, error) {
+	clusterTag := "kubernetes.io/cluster/" + cfg.ClusterName
+
+	vpc, err := ec2.NewVpc(ctx, "vpc", &ec2.VpcArgs{
+		CidrBlock:          pulumi.String(cfg.Vpc.CidrBlock),
+		EnableDnsHostnames: pulumi.Bool(true),
+		EnableDnsSupport:   pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(cfg.ClusterName),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	internetGateway, err := ec2.NewInternetGateway(ctx, "internet-gateway", &ec2.InternetGatewayArgs{
+		VpcId: vpc.ID(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publicRouteTable, err := ec2.NewRouteTable(ctx, "public", &ec2.RouteTableArgs{
+		VpcId: vpc.ID(),
+		Routes: ec2.RouteTableRouteArray{
+			&ec2.RouteTableRouteArgs{
+				CidrBlock: pulumi.String("0.0.0.0/0"),
+				GatewayId: internetGateway.ID(),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var privateSubnetIds pulumi.StringArray
+	var natGateway *ec2.NatGateway
+	for i, zone := range cfg.AvailabilityZones {
+		publicCidr, err := subnetCidr(cfg.Vpc.CidrBlock, i)
+		if err != nil {
+			return nil, err
+		}
+		privateCidr, err := subnetCidr(cfg.Vpc.CidrBlock, len(cfg.AvailabilityZones)+i)
+		if err != nil {
+			return nil, err
+		}
+
+		public, err := ec2.NewSubnet(ctx, "public-"+zone, &ec2.SubnetArgs{
+			VpcId:               vpc.ID(),
+			AvailabilityZone:    pulumi.String(zone),
+			CidrBlock:           pulumi.String(publicCidr),
+			MapPublicIpOnLaunch: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name":                   pulumi.String(cfg.ClusterName + "-public-" + zone),
+				clusterTag:               pulumi.String("shared"),
+				"kubernetes.io/role/elb": pulumi.String("1"),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = ec2.NewRouteTableAssociation(ctx, "public-"+zone, &ec2.RouteTableAssociationArgs{
+			SubnetId:     public.ID(),
+			RouteTableId: publicRouteTable.ID(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if natGateway == nil || !cfg.Vpc.SingleNatGateway {
+			eip, err := ec2.NewEip(ctx, "nat-"+zone, &ec2.EipArgs{
+				Domain: pulumi.String("vpc"),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			natGateway, err = ec2.NewNatGateway(ctx, "nat-"+zone, &ec2.NatGatewayArgs{
+				AllocationId: eip.ID(),
+				SubnetId:     public.ID(),
+			}, pulumi.DependsOn([]pulumi.Resource{
+				internetGateway,
+			}))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		private, err := ec2.NewSubnet(ctx, "private-"+zone, &ec2.SubnetArgs{
+			VpcId:            vpc.ID(),
+			AvailabilityZone: pulumi.String(zone),
+			CidrBlock:        pulumi.String(privateCidr),
+			Tags: pulumi.StringMap{
+				"Name":                            pulumi.String(cfg.ClusterName + "-private-" + zone),
+				clusterTag:                        pulumi.String("shared"),
+				"kubernetes.io/role/internal-elb": pulumi.String("1"),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		privateRouteTable, err := ec2.NewRouteTable(ctx, "private-"+zone, &ec2.RouteTableArgs{
+			VpcId: vpc.ID(),
+			Routes: ec2.RouteTableRouteArray{
+				&ec2.RouteTableRouteArgs{
+					CidrBlock:    pulumi.String("0.0.0.0/0"),
+					NatGatewayId: natGateway.ID(),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = ec2.NewRouteTableAssociation(ctx, "private-"+zone, &ec2.RouteTableAssociationArgs{
+			SubnetId:     private.ID(),
+			RouteTableId: privateRouteTable.ID(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		privateSubnetIds = append(privateSubnetIds, private.ID())
+	}
+
+	return &network{
+		VpcId:     vpc.ID(),
+		SubnetIds: privateSubnetIds,
+	}, nil
+}
+
+// subnetCidr returns the index-th of the subnets splitting the IPv4 CIDR
+// block into 1<<subnetBits
+func subnetCidr(cidrBlock string, index int) (string, error) {
+	_, vpc, err := net.ParseCIDR(cidrBlock)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := vpc.Mask.Size()
+	if ip := vpc.IP.To4(); ip == nil || ones+subnetBits > bits || index >= 1<<subnetBits {
+		return "", fmt.Errorf("no subnet %d in %s", index, cidrBlock)
+	}
+
+	subnet := make(net.IP, net.IPv4len)
+	start := binary.BigEndian.Uint32(vpc.IP.To4()) + uint32(index)<<(bits-ones-subnetBits)
+	binary.BigEndian.PutUint32(subnet, start)
+	return fmt.Sprintf("%s/%d", subnet, ones+subnetBits), nil
+}
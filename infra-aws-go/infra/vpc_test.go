@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestSubnetCidr(t *testing.T) {
+	tests := []struct {
+		cidrBlock string
+		index     int
+		want      string
+	}{
+		{"10.0.0.0/16", 0, "10.0.0.0/20"},
+		{"10.0.0.0/16", 1, "10.0.16.0/20"},
+		{"10.0.0.0/16", 15, "10.0.240.0/20"},
+		{"192.168.4.0/24", 3, "192.168.4.48/28"},
+	}
+	for _, test := range tests {
+		got, err := subnetCidr(test.cidrBlock, test.index)
+		if err != nil || got != test.want {
+			t.Errorf("subnetCidr(%s, %d) = %s, %v, want %s", test.cidrBlock, test.index, got, err, test.want)
+		}
+	}
+
+	if _, err := subnetCidr("10.0.0.0/16", 16); err == nil {
+		t.Error("expected an error past the last subnet")
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	cfg := func(create, singleNatGateway bool) *stackConfig {
+		return &stackConfig{
+			ClusterName:       "demo-eks",
+			AvailabilityZones: []string{"us-east-1a", "us-east-1b"},
+			Vpc:               vpcConfig{Create: create, CidrBlock: "10.0.0.0/16", SingleNatGateway: singleNatGateway},
+		}
+	}
+
+	// subnets returns the subnet ids of the network built for cfg, and the
+	// mocks it was built against
+	subnets := func(t *testing.T, cfg *stackConfig) ([]string, *mocks) {
+		t.Helper()
+		var subnetIds []string
+		var resolved sync.WaitGroup
+		resolved.Add(1)
+		m := runWithMocks(t, func(ctx *pulumi.Context) error {
+			network, err := newNetwork(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			network.SubnetIds.ToStringArrayOutput().ApplyT(func(ids []string) []string {
+				defer resolved.Done()
+				subnetIds = ids
+				return ids
+			})
+			return nil
+		})
+		resolved.Wait()
+		return subnetIds, m
+	}
+
+	t.Run("default VPC", func(t *testing.T) {
+		ids, m := subnets(t, cfg(false, false))
+		if !slices.Equal(ids, []string{"subnet-a", "subnet-b"}) {
+			t.Errorf("subnets = %v, want the default subnets", ids)
+		}
+		if n := m.count("aws:ec2/vpc:Vpc"); n != 0 {
+			t.Errorf("%d VPCs created, want none", n)
+		}
+	})
+
+	t.Run("dedicated VPC", func(t *testing.T) {
+		ids, m := subnets(t, cfg(true, false))
+		if !slices.Equal(ids, []string{"private-us-east-1a-id", "private-us-east-1b-id"}) {
+			t.Errorf("subnets = %v, want the private subnets", ids)
+		}
+
+		public := m.inputs(t, "aws:ec2/subnet:Subnet", "public-us-east-1b")
+		if cidr := public["cidrBlock"].StringValue(); cidr != "10.0.16.0/20" {
+			t.Errorf("public subnet = %s, want 10.0.16.0/20", cidr)
+		}
+		private := m.inputs(t, "aws:ec2/subnet:Subnet", "private-us-east-1b")
+		if cidr := private["cidrBlock"].StringValue(); cidr != "10.0.48.0/20" {
+			t.Errorf("private subnet = %s, want 10.0.48.0/20", cidr)
+		}
+		if role := private["tags"].ObjectValue()["kubernetes.io/role/internal-elb"].StringValue(); role != "1" {
+			t.Errorf("private subnet is not tagged for internal load balancers")
+		}
+
+		if n := m.count("aws:ec2/natGateway:NatGateway"); n != 2 {
+			t.Errorf("%d NAT gateways, want one per zone", n)
+		}
+		route := m.inputs(t, "aws:ec2/routeTable:RouteTable", "private-us-east-1b")["routes"].ArrayValue()[0].ObjectValue()
+		if nat := route["natGatewayId"].StringValue(); nat != "nat-us-east-1b-id" {
+			t.Errorf("private route = %s, want the NAT gateway of the zone", nat)
+		}
+	})
+
+	t.Run("single NAT gateway", func(t *testing.T) {
+		_, m := subnets(t, cfg(true, true))
+		if n := m.count("aws:ec2/natGateway:NatGateway"); n != 1 {
+			t.Errorf("%d NAT gateways, want 1", n)
+		}
+		route := m.inputs(t, "aws:ec2/routeTable:RouteTable", "private-us-east-1b")["routes"].ArrayValue()[0].ObjectValue()
+		if nat := route["natGatewayId"].StringValue(); nat != "nat-us-east-1a-id" {
+			t.Errorf("private route = %s, want the shared NAT gateway", nat)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+// ConversionDataAnnotation holds, as JSON, the fields of a v2 SecretManager
+// that have no v1 equivalent, so they survive a round trip through v1.
+const ConversionDataAnnotation = "my.domain/conversion-data"
+
+// conversionData is the content of the ConversionDataAnnotation.
+type conversionData struct {
+	Sources []mydomainv2.SecretSource `json:"sources"`
+}
+
+// ConvertTo converts this SecretManager (v1) to the Hub version (v2).
+func (src *SecretManager) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*mydomainv2.SecretManager)
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = mydomainv2.SecretManagerSpec{
+		Target: mydomainv2.SecretTarget{
+			Name: src.Spec.Name,
+			Type: src.Spec.Type,
+		},
+		Sources:            sourcesFromV1(src.Spec.SourceSecretName),
+		RefreshInterval:    src.Spec.RefreshInterval.DeepCopy(),
+		PushGenerated:      src.Spec.PushGenerated,
+		RolloutMinInterval: src.Spec.RolloutMinInterval.DeepCopy(),
+	}
+	if src.Spec.Region != "" {
+		dst.Spec.StoreRef = &mydomainv2.StoreRef{Region: src.Spec.Region}
+	}
+	for _, g := range src.Spec.Generators {
+		dst.Spec.Generators = append(dst.Spec.Generators, convertGeneratorTo(g))
+	}
+	for _, t := range src.Spec.RolloutTargets {
+		dst.Spec.RolloutTargets = append(dst.Spec.RolloutTargets, mydomainv2.RolloutTarget{
+			Kind:     mydomainv2.RolloutTargetKind(t.Kind),
+			Name:     t.Name,
+			Selector: t.Selector.DeepCopy(),
+		})
+	}
+
+	// Restore the sources v1 cannot hold, unless sourceSecretName was edited
+	// through v1 since they were saved.
+	if raw, ok := src.Annotations[ConversionDataAnnotation]; ok {
+		dst.Annotations = maps.Clone(src.Annotations)
+		delete(dst.Annotations, ConversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		var data conversionData
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", ConversionDataAnnotation, err)
+		}
+		first := ""
+		if len(data.Sources) > 0 {
+			first = data.Sources[0].SecretName
+		}
+		if first == src.Spec.SourceSecretName {
+			dst.Spec.Sources = data.Sources
+		}
+	}
+
+	dst.Status = mydomainv2.SecretManagerStatus{
+		Conditions:      src.Status.Conditions,
+		SecretHash:      src.Status.SecretHash,
+		LastRolloutTime: src.Status.LastRolloutTime.DeepCopy(),
+	}
+	return nil
+}
+
+// ConvertFrom converts the Hub version (v2) to this version (v1).
+func (dst *SecretManager) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*mydomainv2.SecretManager)
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec = SecretManagerSpec{
+		Name:               src.Spec.Target.Name,
+		Type:               src.Spec.Target.Type,
+		RefreshInterval:    src.Spec.RefreshInterval.DeepCopy(),
+		PushGenerated:      src.Spec.PushGenerated,
+		RolloutMinInterval: src.Spec.RolloutMinInterval.DeepCopy(),
+	}
+	if src.Spec.StoreRef != nil {
+		dst.Spec.Region = src.Spec.StoreRef.Region
+	}
+	if len(src.Spec.Sources) > 0 {
+		dst.Spec.SourceSecretName = src.Spec.Sources[0].SecretName
+	}
+	for _, g := range src.Spec.Generators {
+		dst.Spec.Generators = append(dst.Spec.Generators, convertGeneratorFrom(g))
+	}
+	for _, t := range src.Spec.RolloutTargets {
+		dst.Spec.RolloutTargets = append(dst.Spec.RolloutTargets, RolloutTarget{
+			Kind:     RolloutTargetKind(t.Kind),
+			Name:     t.Name,
+			Selector: t.Selector.DeepCopy(),
+		})
+	}
+
+	// Anything beyond a single source in the default store does not fit in
+	// sourceSecretName, so keep the sources aside for ConvertTo.
+	if !apiequality.Semantic.DeepEqual(src.Spec.Sources, sourcesFromV1(dst.Spec.SourceSecretName)) {
+		raw, err := json.Marshal(conversionData{Sources: src.Spec.Sources})
+		if err != nil {
+			return err
+		}
+		dst.Annotations = maps.Clone(src.Annotations)
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[ConversionDataAnnotation] = string(raw)
+	}
+
+	dst.Status = SecretManagerStatus{
+		Conditions:      src.Status.Conditions,
+		SecretHash:      src.Status.SecretHash,
+		LastRolloutTime: src.Status.LastRolloutTime.DeepCopy(),
+	}
+	return nil
+}
+
+// sourcesFromV1 returns the v2 sources equivalent to sourceSecretName.
+func sourcesFromV1(sourceSecretName string) []mydomainv2.SecretSource {
+	if sourceSecretName == "" {
+		return nil
+	}
+	return []mydomainv2.SecretSource{{SecretName: sourceSecretName}}
+}
+
+func convertGeneratorTo(g Generator) mydomainv2.Generator {
+	out := mydomainv2.Generator{
+		Key:  g.Key,
+		Type: mydomainv2.GeneratorType(g.Type),
+	}
+	if g.Password != nil {
+		out.Password = &mydomainv2.PasswordGenerator{
+			Length:           g.Password.Length,
+			Digits:           g.Password.Digits,
+			Symbols:          g.Password.Symbols,
+			SymbolCharacters: g.Password.SymbolCharacters,
+			NoUpper:          g.Password.NoUpper,
+		}
+	}
+	if g.RSA != nil {
+		out.RSA = &mydomainv2.RSAGenerator{Bits: g.RSA.Bits}
+	}
+	if g.ECDSA != nil {
+		out.ECDSA = &mydomainv2.ECDSAGenerator{Curve: g.ECDSA.Curve}
+	}
+	if g.SSH != nil {
+		out.SSH = &mydomainv2.SSHGenerator{KeyType: g.SSH.KeyType, Bits: g.SSH.Bits, Comment: g.SSH.Comment}
+	}
+	if g.ECR != nil {
+		out.ECR = &mydomainv2.ECRGenerator{Region: g.ECR.Region, RegistryIDs: g.ECR.RegistryIDs}
+	}
+	return out
+}
+
+func convertGeneratorFrom(g mydomainv2.Generator) Generator {
+	out := Generator{
+		Key:  g.Key,
+		Type: GeneratorType(g.Type),
+	}
+	if g.Password != nil {
+		out.Password = &PasswordGenerator{
+			Length:           g.Password.Length,
+			Digits:           g.Password.Digits,
+			Symbols:          g.Password.Symbols,
+			SymbolCharacters: g.Password.SymbolCharacters,
+			NoUpper:          g.Password.NoUpper,
+		}
+	}
+	if g.RSA != nil {
+		out.RSA = &RSAGenerator{Bits: g.RSA.Bits}
+	}
+	if g.ECDSA != nil {
+		out.ECDSA = &ECDSAGenerator{Curve: g.ECDSA.Curve}
+	}
+	if g.SSH != nil {
+		out.SSH = &SSHGenerator{KeyType: g.SSH.KeyType, Bits: g.SSH.Bits, Comment: g.SSH.Comment}
+	}
+	if g.ECR != nil {
+		out.ECR = &ECRGenerator{Region: g.ECR.Region, RegistryIDs: g.ECR.RegistryIDs}
+	}
+	return out
+}
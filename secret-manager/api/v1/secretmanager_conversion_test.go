@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/randfill"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+// fuzzIterations is the number of random objects converted per round trip.
+const fuzzIterations = 1000
+
+// newFiller returns a filler producing SecretManagers the API server would
+// accept, as far as conversion is concerned.
+func newFiller(seed int64) *randfill.Filler {
+	return randfill.NewWithSeed(seed).NilChance(0.3).NumElements(0, 3).Funcs(
+		func(tm *metav1.TypeMeta, _ randfill.Continue) {
+			// Conversion leaves the TypeMeta to the caller.
+			*tm = metav1.TypeMeta{}
+		},
+		func(ref *mydomainv2.StoreRef, c randfill.Continue) {
+			c.FillNoCustom(ref)
+			if ref.Region == "" {
+				ref.Region = "us-east-1"
+			}
+		},
+		func(source *mydomainv2.SecretSource, c randfill.Continue) {
+			c.FillNoCustom(source)
+			if source.SecretName == "" {
+				source.SecretName = "team-a/prod/app"
+			}
+		},
+	)
+}
+
+var _ = Describe("SecretManager conversion", func() {
+	It("Should round trip v1 through the hub", func() {
+		f := newFiller(GinkgoRandomSeed())
+		for range fuzzIterations {
+			original := &SecretManager{}
+			f.Fill(original)
+
+			hub := &mydomainv2.SecretManager{}
+			Expect(original.DeepCopy().ConvertTo(hub)).To(Succeed())
+			converted := &SecretManager{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+
+			Expect(apiequality.Semantic.DeepEqual(original, converted)).To(BeTrue(),
+				"round trip changed the object:\n%#v\n%#v", original, converted)
+		}
+	})
+
+	It("Should round trip the hub through v1", func() {
+		f := newFiller(GinkgoRandomSeed())
+		for range fuzzIterations {
+			original := &mydomainv2.SecretManager{}
+			f.Fill(original)
+
+			spoke := &SecretManager{}
+			Expect(spoke.ConvertFrom(original.DeepCopy())).To(Succeed())
+			converted := &mydomainv2.SecretManager{}
+			Expect(spoke.ConvertTo(converted)).To(Succeed())
+
+			Expect(apiequality.Semantic.DeepEqual(original, converted)).To(BeTrue(),
+				"round trip changed the object:\n%#v\n%#v", original, converted)
+		}
+	})
+
+	It("Should map the v1 fields to the hub", func() {
+		src := &SecretManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a"},
+			Spec: SecretManagerSpec{
+				Name:             "app-secret",
+				SourceSecretName: "team-a/prod/app",
+				Region:           "eu-west-1",
+			},
+		}
+		dst := &mydomainv2.SecretManager{}
+		Expect(src.ConvertTo(dst)).To(Succeed())
+		Expect(dst.Spec.Target.Name).To(Equal("app-secret"))
+		Expect(dst.Spec.Sources).To(Equal([]mydomainv2.SecretSource{{SecretName: "team-a/prod/app"}}))
+		Expect(dst.Spec.StoreRef).To(Equal(&mydomainv2.StoreRef{Region: "eu-west-1"}))
+	})
+
+	It("Should keep extra sources aside when converting to v1", func() {
+		hub := &mydomainv2.SecretManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a"},
+			Spec: mydomainv2.SecretManagerSpec{
+				Target: mydomainv2.SecretTarget{Name: "app-secret"},
+				Sources: []mydomainv2.SecretSource{
+					{SecretName: "team-a/prod/app"},
+					{SecretName: "shared/prod/db", StoreRef: &mydomainv2.StoreRef{Region: "us-east-1"}},
+				},
+			},
+		}
+		spoke := &SecretManager{}
+		Expect(spoke.ConvertFrom(hub)).To(Succeed())
+		Expect(spoke.Spec.SourceSecretName).To(Equal("team-a/prod/app"))
+		Expect(spoke.Annotations).To(HaveKey(ConversionDataAnnotation))
+		Expect(hub.Annotations).To(BeNil())
+
+		By("dropping them once sourceSecretName is changed through v1")
+		spoke.Spec.SourceSecretName = "team-a/prod/other"
+		converted := &mydomainv2.SecretManager{}
+		Expect(spoke.ConvertTo(converted)).To(Succeed())
+		Expect(converted.Spec.Sources).To(Equal([]mydomainv2.SecretSource{{SecretName: "team-a/prod/other"}}))
+		Expect(converted.Annotations).NotTo(HaveKey(ConversionDataAnnotation))
+	})
+})
@@ -0,0 +1,384 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// SecretManagerSpec defines the desired state of SecretManager
+// +kubebuilder:validation:XValidation:rule="(has(self.sources) && size(self.sources) > 0) || (has(self.generators) && size(self.generators) > 0)",message="sources are required unless the Secret only holds generated values"
+// +kubebuilder:validation:XValidation:rule="!has(self.pushGenerated) || !self.pushGenerated || (has(self.sources) && size(self.sources) > 0)",message="pushGenerated requires a source"
+type SecretManagerSpec struct {
+	// target is the Kubernetes Secret written by the operator.
+	// +required
+	Target SecretTarget `json:"target"`
+
+	// storeRef is the AWS store read by sources that do not name their own,
+	// and the default store of generators calling AWS. Without it, the region
+	// of the operator is used.
+	// +optional
+	StoreRef *StoreRef `json:"storeRef,omitempty"`
+
+	// sources are the AWS secrets merged into the target Secret. When two
+	// sources hold the same key, the later one wins.
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Sources []SecretSource `json:"sources,omitempty"`
+
+	// refreshInterval is how often the Secret is synced from AWS. Defaults
+	// to 1h; changes to the ForceSyncAnnotation sync it in between.
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('1s')",message="refreshInterval must be at least 1s"
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+
+	// generators produce values in the operator instead of fetching them from
+	// AWS, and are merged into the target Secret. Generated values are kept
+	// across reconciles and only regenerated when the RegenerateAnnotation
+	// changes.
+	// +listType=map
+	// +listMapKey=key
+	// +kubebuilder:validation:MaxItems=64
+	// +optional
+	Generators []Generator `json:"generators,omitempty"`
+
+	// pushGenerated writes generated values back to the first source,
+	// creating the AWS secret if it does not exist. AWS then becomes the
+	// source of truth for those keys. Short-lived ECR authorization tokens
+	// are never pushed.
+	// +optional
+	PushGenerated bool `json:"pushGenerated,omitempty"`
+
+	// rolloutTargets are workloads restarted when the data of the Secret
+	// changes, so pods reading it as environment variables pick up new values.
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	RolloutTargets []RolloutTarget `json:"rolloutTargets,omitempty"`
+
+	// rolloutMinInterval is the minimum time between two rollouts of the
+	// targets. Changes arriving sooner are rolled out together once the
+	// interval has passed. Defaults to 1m.
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('0s')",message="rolloutMinInterval must not be negative"
+	// +optional
+	RolloutMinInterval *metav1.Duration `json:"rolloutMinInterval,omitempty"`
+}
+
+// SecretTarget describes the Kubernetes Secret written by the operator.
+type SecretTarget struct {
+	// name of the Secret, in the namespace of the SecretManager.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="name is immutable"
+	// +required
+	Name string `json:"name"`
+
+	// type of the Secret. Defaults to kubernetes.io/dockerconfigjson when an
+	// ECRAuthorizationToken generator is declared, and to Opaque otherwise.
+	// +kubebuilder:validation:Enum=Opaque;kubernetes.io/dockerconfigjson;kubernetes.io/tls;kubernetes.io/basic-auth;kubernetes.io/ssh-auth
+	// +optional
+	Type corev1.SecretType `json:"type,omitempty"`
+}
+
+// StoreRef selects an AWS store.
+type StoreRef struct {
+	// region of the store.
+	// +kubebuilder:validation:Pattern=`^[a-z]{2}(-[a-z]+)+-[0-9]$`
+	// +required
+	Region string `json:"region"`
+}
+
+// SecretSource is an AWS Secrets Manager secret read into the target Secret.
+// JSON string secrets are split into one key per field; binary secrets are
+// stored under the "secret" key.
+type SecretSource struct {
+	// secretName is the name or ARN of the secret. The secret is read from
+	// the region of an ARN unless the source has its own storeRef.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9/_+=.@:-]+$`
+	// +required
+	SecretName string `json:"secretName"`
+
+	// storeRef overrides the store of the SecretManager for this source.
+	// +optional
+	StoreRef *StoreRef `json:"storeRef,omitempty"`
+}
+
+// SecretHashAnnotation is set on the pod template of rollout targets to the
+// hash of the Secret data they were last restarted for.
+const SecretHashAnnotation = "my.domain/secret-hash"
+
+// RolloutTargetKind is the kind of workload restarted by a RolloutTarget.
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;DaemonSet
+type RolloutTargetKind string
+
+const (
+	RolloutTargetKindDeployment  RolloutTargetKind = "Deployment"
+	RolloutTargetKindStatefulSet RolloutTargetKind = "StatefulSet"
+	RolloutTargetKindDaemonSet   RolloutTargetKind = "DaemonSet"
+)
+
+// RolloutTarget selects workloads in the namespace of the SecretManager,
+// either by name or by label selector.
+// +kubebuilder:validation:XValidation:rule="has(self.name) != has(self.selector)",message="exactly one of name and selector must be set"
+type RolloutTarget struct {
+	// kind of the workloads.
+	// +required
+	Kind RolloutTargetKind `json:"kind"`
+
+	// name of a single workload.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// selector matches workloads of kind by label.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// DefaultRegion is the AWS region used when neither a SecretManager nor the
+// environment of the operator names one.
+const DefaultRegion = "ap-southeast-1"
+
+// AllowedStoresAnnotation is set on a Namespace to the comma separated list of
+// AWS regions its SecretManagers may read from or generate values with. When
+// unset, every region is allowed.
+const AllowedStoresAnnotation = "my.domain/allowed-stores"
+
+// RegenerateAnnotation is set on a SecretManager to request new generated
+// values. Every change of its value regenerates all generators once.
+const RegenerateAnnotation = "my.domain/regenerate"
+
+// ForceSyncAnnotation is set on a SecretManager, usually by the sync Lambda
+// when its AWS secret changes, to sync it right away instead of waiting for
+// the next refresh. Every change of its value triggers one sync.
+const ForceSyncAnnotation = "my.domain/force-sync"
+
+// ConditionTypeAvailable is the condition reporting whether the target Secret
+// holds the values of the SecretManager.
+const ConditionTypeAvailable = "Available"
+
+// GeneratorType is the kind of value a Generator produces.
+// +kubebuilder:validation:Enum=Password;UUID;RSA;ECDSA;SSH;ECRAuthorizationToken
+type GeneratorType string
+
+const (
+	GeneratorTypePassword GeneratorType = "Password"
+	GeneratorTypeUUID     GeneratorType = "UUID"
+	GeneratorTypeRSA      GeneratorType = "RSA"
+	GeneratorTypeECDSA    GeneratorType = "ECDSA"
+	GeneratorTypeSSH      GeneratorType = "SSH"
+
+	// GeneratorTypeECRAuthorizationToken renders a docker config for ECR
+	// registries. Its key should be ".dockerconfigjson"; the Secret is then of
+	// type kubernetes.io/dockerconfigjson and is refreshed before the token
+	// expires.
+	GeneratorTypeECRAuthorizationToken GeneratorType = "ECRAuthorizationToken"
+)
+
+// ExpiresAtAnnotation is set on Secrets holding short-lived generated values
+// and records, in RFC 3339, when the earliest of them expires.
+const ExpiresAtAnnotation = "my.domain/expires-at"
+
+// Generator declares a value generated by the operator.
+// +kubebuilder:validation:XValidation:rule="!has(self.password) || self.type == 'Password'",message="password is only allowed for Password generators"
+// +kubebuilder:validation:XValidation:rule="!has(self.rsa) || self.type == 'RSA'",message="rsa is only allowed for RSA generators"
+// +kubebuilder:validation:XValidation:rule="!has(self.ecdsa) || self.type == 'ECDSA'",message="ecdsa is only allowed for ECDSA generators"
+// +kubebuilder:validation:XValidation:rule="!has(self.ssh) || self.type == 'SSH'",message="ssh is only allowed for SSH generators"
+// +kubebuilder:validation:XValidation:rule="!has(self.ecr) || self.type == 'ECRAuthorizationToken'",message="ecr is only allowed for ECRAuthorizationToken generators"
+// +kubebuilder:validation:XValidation:rule="self.type != 'ECRAuthorizationToken' || self.key == '.dockerconfigjson'",message="ECR authorization tokens must be written to .dockerconfigjson"
+type Generator struct {
+	// key is the Secret data key the value is written to. Keypair generators
+	// write the private key to key and the public key to key + ".pub".
+	// +kubebuilder:validation:MaxLength=249
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// +required
+	Key string `json:"key"`
+
+	// type selects the generator.
+	// +required
+	Type GeneratorType `json:"type"`
+
+	// password configures the Password generator.
+	// +optional
+	Password *PasswordGenerator `json:"password,omitempty"`
+
+	// rsa configures the RSA generator.
+	// +optional
+	RSA *RSAGenerator `json:"rsa,omitempty"`
+
+	// ecdsa configures the ECDSA generator.
+	// +optional
+	ECDSA *ECDSAGenerator `json:"ecdsa,omitempty"`
+
+	// ssh configures the SSH generator.
+	// +optional
+	SSH *SSHGenerator `json:"ssh,omitempty"`
+
+	// ecr configures the ECRAuthorizationToken generator.
+	// +optional
+	ECR *ECRGenerator `json:"ecr,omitempty"`
+}
+
+// PasswordGenerator generates a random password.
+// +kubebuilder:validation:XValidation:rule="(has(self.digits) ? self.digits : 0) + (has(self.symbols) ? self.symbols : 0) <= (has(self.length) ? self.length : 32)",message="digits and symbols must fit in length"
+type PasswordGenerator struct {
+	// length is the total number of characters. Defaults to 32.
+	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=1024
+	// +optional
+	Length int `json:"length,omitempty"`
+
+	// digits is the minimum number of digits in the password.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Digits int `json:"digits,omitempty"`
+
+	// symbols is the minimum number of symbols in the password.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Symbols int `json:"symbols,omitempty"`
+
+	// symbolCharacters overrides the set of symbols to pick from.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=64
+	// +optional
+	SymbolCharacters string `json:"symbolCharacters,omitempty"`
+
+	// noUpper excludes upper case letters.
+	// +optional
+	NoUpper bool `json:"noUpper,omitempty"`
+}
+
+// RSAGenerator generates a PKCS#8 encoded RSA keypair.
+type RSAGenerator struct {
+	// bits is the key size. Defaults to 2048.
+	// +kubebuilder:validation:Enum=2048;3072;4096
+	// +optional
+	Bits int `json:"bits,omitempty"`
+}
+
+// ECDSAGenerator generates a PKCS#8 encoded ECDSA keypair.
+type ECDSAGenerator struct {
+	// curve is the elliptic curve to use. Defaults to P256.
+	// +kubebuilder:validation:Enum=P256;P384;P521
+	// +optional
+	Curve string `json:"curve,omitempty"`
+}
+
+// ECRGenerator requests an ECR authorization token and renders it as a
+// docker config.
+type ECRGenerator struct {
+	// region of the registries. Defaults to the region of storeRef.
+	// +kubebuilder:validation:Pattern=`^[a-z]{2}(-[a-z]+)+-[0-9]$`
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// registryIDs are the AWS account IDs of the registries to authenticate
+	// to, for pulling across accounts. Defaults to the operator's account.
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:items:Pattern=`^[0-9]{12}$`
+	// +optional
+	RegistryIDs []string `json:"registryIDs,omitempty"`
+}
+
+// SSHGenerator generates an OpenSSH keypair.
+type SSHGenerator struct {
+	// keyType is the SSH key algorithm. Defaults to ed25519.
+	// +kubebuilder:validation:Enum=ed25519;rsa;ecdsa
+	// +optional
+	KeyType string `json:"keyType,omitempty"`
+
+	// bits is the key size for rsa keys. Defaults to 3072.
+	// +kubebuilder:validation:Enum=2048;3072;4096
+	// +optional
+	Bits int `json:"bits,omitempty"`
+
+	// comment is appended to the public key.
+	// +optional
+	Comment string `json:"comment,omitempty"`
+}
+
+// SecretManagerStatus defines the observed state of SecretManager.
+type SecretManagerStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+
+	// For Kubernetes API conventions, see:
+	// https://github.com/kubernetes/community/blob/master/contributors/devel/sig-architecture/api-conventions.md#typical-status-properties
+
+	// conditions represent the current state of the SecretManager resource.
+	// Each condition has a unique type and reflects the status of a specific aspect of the resource.
+	//
+	// Standard condition types include:
+	// - "Available": the resource is fully functional
+	// - "Progressing": the resource is being created or updated
+	// - "Degraded": the resource failed to reach or maintain its desired state
+	//
+	// The status of each condition is one of True, False, or Unknown.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// secretHash is the hash of the Secret data the rollout targets run with.
+	// +optional
+	SecretHash string `json:"secretHash,omitempty"`
+
+	// lastRolloutTime is when the rollout targets were last restarted.
+	// +optional
+	LastRolloutTime *metav1.Time `json:"lastRolloutTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+
+// SecretManager is the Schema for the secretmanagers API
+type SecretManager struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the desired state of SecretManager
+	// +required
+	Spec SecretManagerSpec `json:"spec"`
+
+	// status defines the observed state of SecretManager
+	// +optional
+	Status SecretManagerStatus `json:"status,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretManagerList contains a list of SecretManager
+type SecretManagerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []SecretManager `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretManager{}, &SecretManagerList{})
+}
@@ -36,7 +36,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	mydomainv1 "github.com/huonguyenlt/secret-manager/api/v1"
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
 	"github.com/huonguyenlt/secret-manager/internal/controller"
+	webhookv2 "github.com/huonguyenlt/secret-manager/internal/webhook/v2"
+	"github.com/huonguyenlt/secret-manager/pkg/secretdata"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,6 +52,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(mydomainv1.AddToScheme(scheme))
+	utilruntime.Must(mydomainv2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -61,6 +65,7 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var secretData secretdata.Options
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -79,6 +84,9 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&secretData.Separator, "flatten-separator", "",
+		"If set, nested objects in JSON secrets are flattened into one key per field, joined with this separator. "+
+			"Must match FLATTEN_SEPARATOR of the sync Lambda.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -179,12 +187,20 @@ func main() {
 	}
 
 	if err := (&controller.SecretManagerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:     mgr.GetClient(),
+		Scheme:     mgr.GetScheme(),
+		SecretData: secretData,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SecretManager")
 		os.Exit(1)
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookv2.SetupSecretManagerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SecretManager")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
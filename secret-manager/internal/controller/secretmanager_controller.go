@@ -18,27 +18,47 @@ package controller
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	mydomainv1 "github.com/huonguyenlt/secret-manager/api/v1"
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+	"github.com/huonguyenlt/secret-manager/pkg/secretdata"
+)
+
+// defaultRequeueInterval is how often a SecretManager is synced again when it
+// does not set refreshInterval.
+const defaultRequeueInterval = time.Hour
+
+// Reasons of the Available condition.
+const (
+	reasonSynced              = "Synced"
+	reasonSecretNotControlled = "SecretNotControlled"
 )
 
 // SecretManagerReconciler reconciles a SecretManager object
 type SecretManagerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// SecretData controls how AWS secrets are split into Secret keys
+	SecretData secretdata.Options
 }
 
 // +kubebuilder:rbac:groups=my.domain,resources=secretmanagers,verbs=get;list;watch;create;update;patch;delete
@@ -58,56 +78,110 @@ type SecretManagerReconciler struct {
 func (r *SecretManagerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := logf.FromContext(ctx)
 
-	var sm mydomainv1.SecretManager
+	var sm mydomainv2.SecretManager
 	if err := r.Get(ctx, req.NamespacedName, &sm); err != nil {
 		// Ignore not-found errors, requeue on others
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Load AWS config with region
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("ap-southeast-1"))
-	if err != nil {
-		log.Error(err, "unable to load AWS config")
-		return ctrl.Result{}, err
+	// Get the secret values from AWS, one client per store. A missing first
+	// source is only acceptable when we are about to create it from
+	// generated values.
+	clients := map[string]*secretsmanager.Client{}
+	var awsData, pushData map[string][]byte
+	var pushSecret *secretsmanager.GetSecretValueOutput
+	awsMissing := false
+	for i, source := range sm.Spec.Sources {
+		region := sourceRegion(&sm, source)
+		svc, ok := clients[region]
+		if !ok {
+			cfg, err := loadAWSConfig(ctx, region)
+			if err != nil {
+				log.Error(err, "unable to load AWS config")
+				return ctrl.Result{}, err
+			}
+			// Create AWS Secrets Manager client
+			svc = secretsmanager.NewFromConfig(cfg)
+			clients[region] = svc
+		}
+
+		secret, err := getAWSSecret(ctx, svc, source.SecretName)
+		if err != nil {
+			var notFound *smtypes.ResourceNotFoundException
+			if i > 0 || !sm.Spec.PushGenerated || !errors.As(err, &notFound) {
+				log.Error(err, fmt.Sprintf("failed to get secret %s from AWS", source.SecretName))
+				return ctrl.Result{}, err
+			}
+			awsMissing = true
+		}
+		var data map[string][]byte
+		if secret != nil {
+			data, err = secretdata.Decode(secret.SecretString, secret.SecretBinary, r.SecretData)
+			if err != nil {
+				log.Error(err, fmt.Sprintf("failed to decode secret %s", source.SecretName))
+				return ctrl.Result{}, err
+			}
+		}
+		if i == 0 {
+			pushData, pushSecret = data, secret
+		}
+		if awsData == nil {
+			awsData = map[string][]byte{}
+		}
+		maps.Copy(awsData, data)
 	}
 
-	// Create AWS Secrets Manager client
-	svc := secretsmanager.NewFromConfig(cfg)
+	var existingSecret v1.Secret
+	err := r.Get(ctx, client.ObjectKey{Name: sm.Spec.Target.Name, Namespace: sm.Namespace}, &existingSecret)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to get k8s secret")
+		return ctrl.Result{}, err
+	}
+	secretExists := err == nil
 
-	// Get the secret value from AWS
-	awsSecretName := sm.Spec.SourceSecretName
-	getOut, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-		SecretId: aws.String(awsSecretName),
-	})
+	secretData := maps.Clone(awsData)
+	if secretData == nil {
+		secretData = map[string][]byte{}
+	}
+	var current *v1.Secret
+	if secretExists {
+		current = &existingSecret
+	}
+	expiresAt, err := r.applyGenerators(ctx, &sm, current, secretData)
 	if err != nil {
-		log.Error(err, fmt.Sprintf("failed to get secret %s from AWS", awsSecretName))
+		log.Error(err, "failed to generate secret values")
 		return ctrl.Result{}, err
 	}
 
-	// Parse the secret string as JSON to map[string][]byte for K8s Secret
-	secretData := map[string][]byte{}
-	if getOut.SecretString != nil {
-		var tmp map[string]string
-		if err := json.Unmarshal([]byte(*getOut.SecretString), &tmp); err != nil {
-			log.Error(err, "failed to unmarshal AWS secret string")
-			return ctrl.Result{}, err
+	if sm.Spec.PushGenerated && len(sm.Spec.Sources) > 0 && (awsMissing || !generatedValuesEqual(sm.Spec.Generators, pushData, secretData)) {
+		source := sm.Spec.Sources[0]
+		// Only the generated keys are pushed; values of later sources stay
+		// where they are
+		pushed := map[string][]byte{}
+		for _, k := range pushedKeys(sm.Spec.Generators) {
+			pushed[k] = secretData[k]
 		}
-		for k, v := range tmp {
-			secretData[k] = []byte(v)
+		if err := pushAWSSecretData(ctx, clients[sourceRegion(&sm, source)], source.SecretName, pushSecret, pushed); err != nil {
+			log.Error(err, fmt.Sprintf("failed to push generated values to AWS secret %s", source.SecretName))
+			return ctrl.Result{}, err
 		}
-	} else if getOut.SecretBinary != nil {
-		// Optionally handle binary secrets
-		secretData["secret"] = getOut.SecretBinary
+		log.Info(fmt.Sprintf("Pushed generated values to AWS secret %s", source.SecretName))
 	}
 
 	// Create or update the Kubernetes Secret
 	k8sSecret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      sm.Spec.Name,
+			Name:      sm.Spec.Target.Name,
 			Namespace: sm.Namespace,
 		},
 		Data: secretData,
-		Type: v1.SecretTypeOpaque,
+		Type: secretType(&sm),
+	}
+	if token, ok := sm.Annotations[mydomainv2.RegenerateAnnotation]; ok {
+		metav1.SetMetaDataAnnotation(&k8sSecret.ObjectMeta, mydomainv2.RegenerateAnnotation, token)
+	}
+	if !expiresAt.IsZero() {
+		metav1.SetMetaDataAnnotation(&k8sSecret.ObjectMeta, mydomainv2.ExpiresAtAnnotation, expiresAt.UTC().Format(time.RFC3339))
 	}
 
 	// Set owner reference for garbage collection
@@ -116,12 +190,34 @@ func (r *SecretManagerReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// The type of a Secret is immutable, so a changed type means replacing it.
+	// Only a Secret of this SecretManager is replaced.
+	if secretExists && existingSecret.Type != k8sSecret.Type {
+		if !metav1.IsControlledBy(&existingSecret, &sm) {
+			message := fmt.Sprintf("Secret %s has type %s and is not controlled by this SecretManager", existingSecret.Name, existingSecret.Type)
+			log.Info(message)
+			if err := r.setAvailable(ctx, &sm, metav1.ConditionFalse, reasonSecretNotControlled, message); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: refreshInterval(&sm)}, nil
+		}
+		if err := r.Delete(ctx, &existingSecret); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "failed to delete k8s secret with outdated type")
+			return ctrl.Result{}, err
+		}
+		log.Info(fmt.Sprintf("Deleted Kubernetes secret %s to change its type to %s", k8sSecret.Name, k8sSecret.Type))
+		secretExists = false
+	}
+
 	// Try to create or update the secret
-	var existingSecret v1.Secret
-	err = r.Get(ctx, client.ObjectKey{Name: k8sSecret.Name, Namespace: k8sSecret.Namespace}, &existingSecret)
-	if err == nil {
+	if secretExists {
 		// Secret exists, only update if data has changed
 		needUpdate := false
+		for _, key := range []string{mydomainv2.RegenerateAnnotation, mydomainv2.ExpiresAtAnnotation} {
+			if existingSecret.Annotations[key] != k8sSecret.Annotations[key] {
+				needUpdate = true
+			}
+		}
 		if len(existingSecret.Data) != len(k8sSecret.Data) {
 			needUpdate = true
 		} else {
@@ -135,6 +231,13 @@ func (r *SecretManagerReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		if needUpdate {
 			existingSecret.Data = k8sSecret.Data
 			existingSecret.Type = k8sSecret.Type
+			for _, key := range []string{mydomainv2.RegenerateAnnotation, mydomainv2.ExpiresAtAnnotation} {
+				if value, ok := k8sSecret.Annotations[key]; ok {
+					metav1.SetMetaDataAnnotation(&existingSecret.ObjectMeta, key, value)
+				} else {
+					delete(existingSecret.Annotations, key)
+				}
+			}
 			if err := r.Update(ctx, &existingSecret); err != nil {
 				log.Error(err, "failed to update existing k8s secret")
 				return ctrl.Result{}, err
@@ -143,27 +246,149 @@ func (r *SecretManagerReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		} else {
 			log.Info(fmt.Sprintf("Kubernetes secret %s is up to date", k8sSecret.Name))
 		}
-	} else if client.IgnoreNotFound(err) == nil {
+	} else {
 		// Secret does not exist, create it
 		if err := r.Create(ctx, k8sSecret); err != nil {
 			log.Error(err, "failed to create k8s secret")
 			return ctrl.Result{}, err
 		}
 		log.Info(fmt.Sprintf("Created Kubernetes secret %s", k8sSecret.Name))
-	} else {
-		// Some other error
-		log.Error(err, "failed to get k8s secret")
+	}
+
+	// Restart workloads reading the Secret once its data has changed
+	rolloutIn, err := r.reconcileRollout(ctx, &sm, k8sSecret.Data)
+	if err != nil {
+		log.Error(err, "failed to roll out workloads")
 		return ctrl.Result{}, err
 	}
 
-	// At the end of the function, always requeue after a fixed interval
-	return ctrl.Result{RequeueAfter: time.Second * 10}, nil // 10 seconds
+	if err := r.setAvailable(ctx, &sm, metav1.ConditionTrue, reasonSynced, "Secret is in sync"); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// At the end of the function, always requeue after the refresh interval, or
+	// earlier when a generated token needs refreshing before it expires or a
+	// postponed rollout is due
+	requeueAfter := refreshInterval(&sm)
+	if !expiresAt.IsZero() {
+		if refreshIn := time.Until(expiresAt) - ecrTokenRefreshMargin; refreshIn < requeueAfter {
+			requeueAfter = max(refreshIn, time.Second)
+		}
+	}
+	if rolloutIn > 0 && rolloutIn < requeueAfter {
+		requeueAfter = rolloutIn
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// refreshInterval returns how often sm is synced again.
+func refreshInterval(sm *mydomainv2.SecretManager) time.Duration {
+	if sm.Spec.RefreshInterval != nil {
+		return sm.Spec.RefreshInterval.Duration
+	}
+	return defaultRequeueInterval
+}
+
+// setAvailable records the Available condition of sm, patching the status only
+// when the condition changes.
+func (r *SecretManagerReconciler) setAvailable(ctx context.Context, sm *mydomainv2.SecretManager,
+	status metav1.ConditionStatus, reason, message string) error {
+	original := sm.DeepCopy()
+	changed := meta.SetStatusCondition(&sm.Status.Conditions, metav1.Condition{
+		Type:               mydomainv2.ConditionTypeAvailable,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: sm.Generation,
+	})
+	if !changed {
+		return nil
+	}
+	if err := r.Status().Patch(ctx, sm, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("failed to record condition %s: %w", mydomainv2.ConditionTypeAvailable, err)
+	}
+	return nil
+}
+
+// storeRegion returns the region of the store of sm, or the empty string when
+// it does not name one.
+func storeRegion(sm *mydomainv2.SecretManager) string {
+	if sm.Spec.StoreRef == nil {
+		return ""
+	}
+	return sm.Spec.StoreRef.Region
+}
+
+// sourceRegion returns the region of the store holding source: the region of
+// its own storeRef, then the region of its ARN, then the store of sm.
+func sourceRegion(sm *mydomainv2.SecretManager, source mydomainv2.SecretSource) string {
+	if source.StoreRef != nil {
+		return source.StoreRef.Region
+	}
+	if parsed, err := arn.Parse(source.SecretName); err == nil {
+		return parsed.Region
+	}
+	return storeRegion(sm)
+}
+
+// loadAWSConfig loads the default AWS config for region. When region is
+// empty, the region of the operator is used: AWS_REGION or the shared config,
+// then mydomainv2.DefaultRegion when neither sets one.
+func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithDefaultRegion(mydomainv2.DefaultRegion)}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	return config.LoadDefaultConfig(ctx, opts...)
+}
+
+// getAWSSecret fetches the current value of an AWS secret.
+func getAWSSecret(ctx context.Context, svc *secretsmanager.Client, name string) (*secretsmanager.GetSecretValueOutput, error) {
+	return svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+}
+
+// pushAWSSecretData merges data into current, the value of the secret as
+// fetched, and writes it back. Fields other than the keys of data are written
+// back as they were. The secret is created when current is nil.
+func pushAWSSecretData(ctx context.Context, svc *secretsmanager.Client, name string,
+	current *secretsmanager.GetSecretValueOutput, data map[string][]byte) error {
+	if current == nil {
+		secretString, err := secretdata.Merge(nil, data)
+		if err != nil {
+			return err
+		}
+		_, err = svc.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+			Name:         aws.String(name),
+			SecretString: aws.String(secretString),
+		})
+		return err
+	}
+
+	if current.SecretString == nil {
+		return fmt.Errorf("secret %s holds binary data, generated values can not be merged into it", name)
+	}
+	secretString, err := secretdata.Merge(current.SecretString, data)
+	if err != nil {
+		return fmt.Errorf("secret %s: %w", name, err)
+	}
+	_, err = svc.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(secretString),
+	})
+	return err
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Besides spec
+// changes, annotation changes trigger a reconcile, so setting the
+// ForceSyncAnnotation or the RegenerateAnnotation takes effect right away.
 func (r *SecretManagerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&mydomainv1.SecretManager{}).
+		For(&mydomainv2.SecretManager{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		))).
 		Named("secretmanager").
 		Complete(r)
 }
@@ -21,16 +21,23 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	mydomainv1 "github.com/huonguyenlt/secret-manager/api/v1"
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
 )
 
-var _ = Describe("SecretManager Controller", func() {
+var _ = Describe("SecretManager Controller", Label(envtestLabel), func() {
 	Context("When reconciling a resource", func() {
 		const resourceName = "test-resource"
 
@@ -40,31 +47,40 @@ var _ = Describe("SecretManager Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		secretmanager := &mydomainv1.SecretManager{}
+		secretmanager := &mydomainv2.SecretManager{}
 
 		BeforeEach(func() {
 			By("creating the custom resource for the Kind SecretManager")
 			err := k8sClient.Get(ctx, typeNamespacedName, secretmanager)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &mydomainv1.SecretManager{
+				resource := &mydomainv2.SecretManager{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
 					},
-					// TODO(user): Specify other spec details if needed.
+					// A generated value only, so reconciling calls no AWS API
+					Spec: mydomainv2.SecretManagerSpec{
+						Target: mydomainv2.SecretTarget{Name: "app-secret"},
+						Generators: []mydomainv2.Generator{
+							{Key: "password", Type: mydomainv2.GeneratorTypePassword},
+						},
+					},
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 			}
 		})
 
 		AfterEach(func() {
-			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &mydomainv1.SecretManager{}
+			resource := &mydomainv2.SecretManager{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 
 			By("Cleanup the specific resource instance SecretManager")
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			// envtest runs no garbage collector to delete the owned Secret
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-secret", Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, secret))).To(Succeed())
 		})
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
@@ -77,8 +93,136 @@ var _ = Describe("SecretManager Controller", func() {
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("Checking the generated Secret")
+			var secret corev1.Secret
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "app-secret", Namespace: "default"}, &secret)).To(Succeed())
+			Expect(secret.Type).To(Equal(corev1.SecretTypeOpaque))
+			Expect(secret.Data).To(HaveKey("password"))
+
+			By("Checking the Available condition")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, secretmanager)).To(Succeed())
+			Expect(metav1.IsControlledBy(&secret, secretmanager)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(secretmanager.Status.Conditions, mydomainv2.ConditionTypeAvailable)).To(BeTrue())
 		})
 	})
 })
+
+var _ = Describe("SecretManager target ownership", func() {
+	var (
+		ctx        context.Context
+		reconciler *SecretManagerReconciler
+		sm         *mydomainv2.SecretManager
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mydomainv2.AddToScheme(scheme)).To(Succeed())
+
+		sm = &mydomainv2.SecretManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default", UID: "sm-uid"},
+			Spec: mydomainv2.SecretManagerSpec{
+				Target: mydomainv2.SecretTarget{Name: "app-secret", Type: corev1.SecretTypeTLS},
+			},
+		}
+		reconciler = &SecretManagerReconciler{
+			Client: fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&mydomainv2.SecretManager{}).
+				WithObjects(sm).
+				Build(),
+			Scheme: scheme,
+		}
+	})
+
+	reconcileSM := func() {
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(sm)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(sm), sm)).To(Succeed())
+	}
+
+	It("should not replace a Secret of another type it does not control", func() {
+		other := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-secret", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("keep")},
+			Type:       corev1.SecretTypeOpaque,
+		}
+		Expect(reconciler.Create(ctx, other)).To(Succeed())
+
+		reconcileSM()
+
+		var secret corev1.Secret
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(other), &secret)).To(Succeed())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeOpaque))
+		Expect(secret.Data).To(HaveKeyWithValue("password", []byte("keep")))
+
+		condition := meta.FindStatusCondition(sm.Status.Conditions, mydomainv2.ConditionTypeAvailable)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(reasonSecretNotControlled))
+	})
+
+	It("should replace its own Secret when the type changes", func() {
+		own := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-secret", Namespace: "default"},
+			Type:       corev1.SecretTypeOpaque,
+		}
+		Expect(controllerutil.SetControllerReference(sm, own, reconciler.Scheme)).To(Succeed())
+		Expect(reconciler.Create(ctx, own)).To(Succeed())
+
+		reconcileSM()
+
+		var secret corev1.Secret
+		Expect(reconciler.Get(ctx, client.ObjectKeyFromObject(own), &secret)).To(Succeed())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(meta.IsStatusConditionTrue(sm.Status.Conditions, mydomainv2.ConditionTypeAvailable)).To(BeTrue())
+	})
+})
+
+var _ = DescribeTable("sourceRegion",
+	func(storeRef *mydomainv2.StoreRef, source mydomainv2.SecretSource, expected string) {
+		sm := &mydomainv2.SecretManager{Spec: mydomainv2.SecretManagerSpec{StoreRef: storeRef}}
+		Expect(sourceRegion(sm, source)).To(Equal(expected))
+	},
+	Entry("store of the SecretManager", &mydomainv2.StoreRef{Region: "eu-west-1"},
+		mydomainv2.SecretSource{SecretName: "app"}, "eu-west-1"),
+	Entry("no store", nil, mydomainv2.SecretSource{SecretName: "app"}, ""),
+	Entry("region of the ARN", &mydomainv2.StoreRef{Region: "eu-west-1"},
+		mydomainv2.SecretSource{SecretName: "arn:aws:secretsmanager:us-east-1:111111111111:secret:app-AbCdEf"}, "us-east-1"),
+	Entry("store of the source", &mydomainv2.StoreRef{Region: "eu-west-1"},
+		mydomainv2.SecretSource{
+			SecretName: "arn:aws:secretsmanager:us-east-1:111111111111:secret:app-AbCdEf",
+			StoreRef:   &mydomainv2.StoreRef{Region: "us-west-2"},
+		}, "us-west-2"),
+)
+
+var _ = Describe("loadAWSConfig", func() {
+	BeforeEach(func() {
+		GinkgoT().Setenv("AWS_REGION", "")
+		GinkgoT().Setenv("AWS_DEFAULT_REGION", "")
+		GinkgoT().Setenv("AWS_CONFIG_FILE", "/nonexistent")
+		GinkgoT().Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	})
+
+	It("should use the region of the store", func() {
+		GinkgoT().Setenv("AWS_REGION", "us-east-1")
+		cfg, err := loadAWSConfig(context.Background(), "eu-west-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Region).To(Equal("eu-west-1"))
+	})
+
+	It("should use the region of the environment without a store", func() {
+		GinkgoT().Setenv("AWS_REGION", "us-east-1")
+		cfg, err := loadAWSConfig(context.Background(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Region).To(Equal("us-east-1"))
+	})
+
+	It("should use the default region without any", func() {
+		cfg, err := loadAWSConfig(context.Background(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Region).To(Equal(mydomainv2.DefaultRegion))
+	})
+})
@@ -0,0 +1,173 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	v1 "k8s.io/api/core/v1"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+	"github.com/huonguyenlt/secret-manager/internal/generator"
+)
+
+// ecrTokenRefreshMargin is how long before expiry an ECR authorization token
+// is replaced.
+const ecrTokenRefreshMargin = time.Hour
+
+// applyGenerators merges the values of sm's generators into data, which holds
+// the values fetched from AWS. Values already in the existing Secret (or in
+// AWS when pushGenerated is set) are reused, so generated values stay stable
+// across reconciles. Everything is generated again when the value of the
+// regenerate annotation differs from the one recorded on the Secret.
+//
+// It returns the earliest expiry of short-lived values, or the zero time when
+// there are none.
+func (r *SecretManagerReconciler) applyGenerators(ctx context.Context, sm *mydomainv2.SecretManager,
+	existing *v1.Secret, data map[string][]byte) (time.Time, error) {
+	regenerate := false
+	var existingExpiry time.Time
+	if existing != nil {
+		regenerate = sm.Annotations[mydomainv2.RegenerateAnnotation] !=
+			existing.Annotations[mydomainv2.RegenerateAnnotation]
+		existingExpiry, _ = time.Parse(time.RFC3339, existing.Annotations[mydomainv2.ExpiresAtAnnotation])
+	}
+
+	var expiresAt time.Time
+	for _, g := range sm.Spec.Generators {
+		keys := generator.Keys(g)
+
+		if g.Type == mydomainv2.GeneratorTypeECRAuthorizationToken {
+			// Tokens are never taken from AWS, and are only reused while
+			// they are not about to expire.
+			if !regenerate && existing != nil && hasKeys(existing.Data, keys) &&
+				time.Until(existingExpiry) > ecrTokenRefreshMargin {
+				data[g.Key] = existing.Data[g.Key]
+				expiresAt = earliest(expiresAt, existingExpiry)
+				continue
+			}
+			dockerConfig, tokenExpiry, err := r.ecrDockerConfig(ctx, g, storeRegion(sm))
+			if err != nil {
+				return time.Time{}, fmt.Errorf("generator %q: %w", g.Key, err)
+			}
+			data[g.Key] = dockerConfig
+			expiresAt = earliest(expiresAt, tokenExpiry)
+			continue
+		}
+
+		if !regenerate {
+			if sm.Spec.PushGenerated && hasKeys(data, keys) {
+				continue
+			}
+			if existing != nil && hasKeys(existing.Data, keys) {
+				for _, k := range keys {
+					data[k] = existing.Data[k]
+				}
+				continue
+			}
+		}
+
+		values, err := generator.Generate(g)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("generator %q: %w", g.Key, err)
+		}
+		for k, v := range values {
+			data[k] = v
+		}
+	}
+	return expiresAt, nil
+}
+
+// ecrDockerConfig renders the docker config for an ECRAuthorizationToken
+// generator. The token is requested in defaultRegion unless the generator sets
+// its own region.
+func (r *SecretManagerReconciler) ecrDockerConfig(ctx context.Context, g mydomainv2.Generator,
+	defaultRegion string) ([]byte, time.Time, error) {
+	opts := mydomainv2.ECRGenerator{}
+	if g.ECR != nil {
+		opts = *g.ECR
+	}
+	region := opts.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return generator.ECRDockerConfig(ctx, ecr.NewFromConfig(cfg), cfg.Region, opts.RegistryIDs)
+}
+
+// secretType returns the type of the Secret rendered for sm.
+func secretType(sm *mydomainv2.SecretManager) v1.SecretType {
+	if sm.Spec.Target.Type != "" {
+		return sm.Spec.Target.Type
+	}
+	for _, g := range sm.Spec.Generators {
+		if g.Type == mydomainv2.GeneratorTypeECRAuthorizationToken {
+			return v1.SecretTypeDockerConfigJson
+		}
+	}
+	return v1.SecretTypeOpaque
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// pushedKeys returns the keys written by generators that pushGenerated
+// stores in AWS. ECR authorization tokens are short-lived and refreshed by
+// every cluster on its own, so they stay out of AWS.
+func pushedKeys(generators []mydomainv2.Generator) []string {
+	var keys []string
+	for _, g := range generators {
+		if g.Type == mydomainv2.GeneratorTypeECRAuthorizationToken {
+			continue
+		}
+		keys = append(keys, generator.Keys(g)...)
+	}
+	return keys
+}
+
+// generatedValuesEqual reports whether a and b hold the same values for every
+// pushed key.
+func generatedValuesEqual(generators []mydomainv2.Generator, a, b map[string][]byte) bool {
+	for _, k := range pushedKeys(generators) {
+		av, aok := a[k]
+		bv, bok := b[k]
+		if aok != bok || !bytes.Equal(av, bv) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasKeys(data map[string][]byte, keys []string) bool {
+	for _, k := range keys {
+		if _, ok := data[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
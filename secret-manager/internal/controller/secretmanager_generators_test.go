@@ -0,0 +1,51 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+var _ = Describe("SecretManager generators", func() {
+	generators := []mydomainv2.Generator{
+		{Key: "password", Type: mydomainv2.GeneratorTypePassword},
+		{Key: "id_rsa", Type: mydomainv2.GeneratorTypeRSA},
+		{Key: ".dockerconfigjson", Type: mydomainv2.GeneratorTypeECRAuthorizationToken},
+	}
+
+	It("should push every generated key but the ECR token", func() {
+		Expect(pushedKeys(generators)).To(Equal([]string{"password", "id_rsa", "id_rsa.pub"}))
+	})
+
+	It("should ignore the ECR token when comparing generated values", func() {
+		a := map[string][]byte{
+			"password": []byte("p"), "id_rsa": []byte("k"), "id_rsa.pub": []byte("pub"),
+			".dockerconfigjson": []byte("old"),
+		}
+		b := map[string][]byte{
+			"password": []byte("p"), "id_rsa": []byte("k"), "id_rsa.pub": []byte("pub"),
+			".dockerconfigjson": []byte("new"),
+		}
+		Expect(generatedValuesEqual(generators, a, b)).To(BeTrue())
+
+		b["password"] = []byte("q")
+		Expect(generatedValuesEqual(generators, a, b)).To(BeFalse())
+	})
+})
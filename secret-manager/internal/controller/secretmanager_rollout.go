@@ -0,0 +1,193 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+// defaultRolloutMinInterval is the minimum time between two rollouts when a
+// SecretManager does not set rolloutMinInterval.
+const defaultRolloutMinInterval = time.Minute
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch;patch
+
+// reconcileRollout restarts the rollout targets of sm once the Secret data
+// hashes to something other than what the targets were last restarted for.
+// The first hash seen is only recorded, so adding rolloutTargets does not
+// restart anything. Rollouts closer together than the minimum interval are
+// postponed; the returned duration is then the time left to wait. ECR
+// authorization tokens are left out of the hash: refreshing them changes
+// nothing the workloads rely on.
+func (r *SecretManagerReconciler) reconcileRollout(ctx context.Context, sm *mydomainv2.SecretManager,
+	data map[string][]byte) (time.Duration, error) {
+	log := logf.FromContext(ctx)
+
+	hash := hashSecretData(rolloutData(sm, data))
+	if sm.Status.SecretHash == hash {
+		return 0, nil
+	}
+
+	original := sm.DeepCopy()
+	if sm.Status.SecretHash != "" && len(sm.Spec.RolloutTargets) > 0 {
+		minInterval := defaultRolloutMinInterval
+		if sm.Spec.RolloutMinInterval != nil {
+			minInterval = sm.Spec.RolloutMinInterval.Duration
+		}
+		if sm.Status.LastRolloutTime != nil {
+			if wait := time.Until(sm.Status.LastRolloutTime.Add(minInterval)); wait > 0 {
+				log.Info(fmt.Sprintf("Postponing rollout of secret %s for %s", sm.Spec.Target.Name, wait))
+				return wait, nil
+			}
+		}
+
+		for _, target := range sm.Spec.RolloutTargets {
+			if err := r.rolloutTarget(ctx, sm.Namespace, target, hash); err != nil {
+				return 0, err
+			}
+		}
+		now := metav1.Now()
+		sm.Status.LastRolloutTime = &now
+	}
+
+	sm.Status.SecretHash = hash
+	if err := r.Status().Patch(ctx, sm, client.MergeFrom(original)); err != nil {
+		return 0, fmt.Errorf("failed to record secret hash: %w", err)
+	}
+	return 0, nil
+}
+
+// rolloutTarget sets the secret hash annotation on the pod template of every
+// workload matched by target, which makes their controllers roll them out.
+func (r *SecretManagerReconciler) rolloutTarget(ctx context.Context, namespace string,
+	target mydomainv2.RolloutTarget, hash string) error {
+	log := logf.FromContext(ctx)
+
+	var objs []client.Object
+	if target.Name != "" {
+		obj, _, err := newRolloutObjects(target.Kind)
+		if err != nil {
+			return err
+		}
+		if err := r.Get(ctx, client.ObjectKey{Name: target.Name, Namespace: namespace}, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				log.Info(fmt.Sprintf("Rollout target %s %s not found, skipping", target.Kind, target.Name))
+				return nil
+			}
+			return err
+		}
+		objs = append(objs, obj)
+	} else {
+		_, list, err := newRolloutObjects(target.Kind)
+		if err != nil {
+			return err
+		}
+		selector, err := metav1.LabelSelectorAsSelector(target.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid rollout target selector: %w", err)
+		}
+		if err := r.List(ctx, list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			objs = append(objs, item.(client.Object))
+		}
+	}
+
+	for _, obj := range objs {
+		patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		template := podTemplate(obj)
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[mydomainv2.SecretHashAnnotation] = hash
+		if err := r.Patch(ctx, obj, patch); err != nil {
+			return fmt.Errorf("failed to roll out %s %s: %w", target.Kind, obj.GetName(), err)
+		}
+		log.Info(fmt.Sprintf("Rolled out %s %s", target.Kind, obj.GetName()))
+	}
+	return nil
+}
+
+func newRolloutObjects(kind mydomainv2.RolloutTargetKind) (client.Object, client.ObjectList, error) {
+	switch kind {
+	case mydomainv2.RolloutTargetKindDeployment:
+		return &appsv1.Deployment{}, &appsv1.DeploymentList{}, nil
+	case mydomainv2.RolloutTargetKindStatefulSet:
+		return &appsv1.StatefulSet{}, &appsv1.StatefulSetList{}, nil
+	case mydomainv2.RolloutTargetKindDaemonSet:
+		return &appsv1.DaemonSet{}, &appsv1.DaemonSetList{}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported rollout target kind %q", kind)
+	}
+}
+
+func podTemplate(obj client.Object) *v1.PodTemplateSpec {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template
+	default:
+		panic(fmt.Sprintf("unexpected rollout object %T", obj))
+	}
+}
+
+// rolloutData returns data without the keys of sm's ECR authorization token
+// generators.
+func rolloutData(sm *mydomainv2.SecretManager, data map[string][]byte) map[string][]byte {
+	data = maps.Clone(data)
+	for _, g := range sm.Spec.Generators {
+		if g.Type == mydomainv2.GeneratorTypeECRAuthorizationToken {
+			delete(data, g.Key)
+		}
+	}
+	return data
+}
+
+// hashSecretData returns a stable hash of Secret data.
+func hashSecretData(data map[string][]byte) string {
+	h := sha256.New()
+	for _, k := range slices.Sorted(maps.Keys(data)) {
+		// Length prefixes keep ("ab", "c") and ("a", "bc") apart.
+		fmt.Fprintf(h, "%d:%s%d:", len(k), k, len(data[k]))
+		h.Write(data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
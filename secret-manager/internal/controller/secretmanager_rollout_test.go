@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+var _ = Describe("SecretManager rollouts", func() {
+	var (
+		ctx        context.Context
+		reconciler *SecretManagerReconciler
+		sm         *mydomainv2.SecretManager
+	)
+
+	deployment := func(name string, labels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		}
+	}
+
+	templateHash := func(name string) string {
+		var d appsv1.Deployment
+		Expect(reconciler.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, &d)).To(Succeed())
+		return d.Spec.Template.Annotations[mydomainv2.SecretHashAnnotation]
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(mydomainv2.AddToScheme(scheme)).To(Succeed())
+
+		sm = &mydomainv2.SecretManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "rollout", Namespace: "default"},
+			Spec: mydomainv2.SecretManagerSpec{
+				Target: mydomainv2.SecretTarget{Name: "app-secret"},
+				RolloutTargets: []mydomainv2.RolloutTarget{
+					{Kind: mydomainv2.RolloutTargetKindDeployment, Name: "api"},
+					{
+						Kind:     mydomainv2.RolloutTargetKindDeployment,
+						Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "worker"}},
+					},
+				},
+			},
+		}
+		reconciler = &SecretManagerReconciler{
+			Client: fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithStatusSubresource(&mydomainv2.SecretManager{}).
+				WithObjects(sm, deployment("api", nil), deployment("worker", map[string]string{"tier": "worker"}),
+					deployment("other", nil)).
+				Build(),
+			Scheme: scheme,
+		}
+	})
+
+	It("should only record the first hash", func() {
+		_, err := reconciler.reconcileRollout(ctx, sm, map[string][]byte{"k": []byte("v1")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sm.Status.SecretHash).NotTo(BeEmpty())
+		Expect(sm.Status.LastRolloutTime).To(BeNil())
+		Expect(templateHash("api")).To(BeEmpty())
+	})
+
+	It("should annotate the targets when the data changes", func() {
+		sm.Status.SecretHash = hashSecretData(map[string][]byte{"k": []byte("v1")})
+		wait, err := reconciler.reconcileRollout(ctx, sm, map[string][]byte{"k": []byte("v2")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+
+		hash := hashSecretData(map[string][]byte{"k": []byte("v2")})
+		Expect(sm.Status.SecretHash).To(Equal(hash))
+		Expect(sm.Status.LastRolloutTime).NotTo(BeNil())
+		Expect(templateHash("api")).To(Equal(hash))
+		Expect(templateHash("worker")).To(Equal(hash))
+		Expect(templateHash("other")).To(BeEmpty())
+	})
+
+	It("should postpone rollouts inside the minimum interval", func() {
+		lastRollout := metav1.NewTime(time.Now().Add(-10 * time.Second))
+		sm.Status.SecretHash = hashSecretData(map[string][]byte{"k": []byte("v1")})
+		sm.Status.LastRolloutTime = &lastRollout
+
+		wait, err := reconciler.reconcileRollout(ctx, sm, map[string][]byte{"k": []byte("v2")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeNumerically("~", 50*time.Second, time.Second))
+		Expect(templateHash("api")).To(BeEmpty())
+	})
+
+	It("should not roll out when only the ECR token changes", func() {
+		sm.Spec.Generators = []mydomainv2.Generator{
+			{Key: ".dockerconfigjson", Type: mydomainv2.GeneratorTypeECRAuthorizationToken},
+		}
+		sm.Status.SecretHash = hashSecretData(map[string][]byte{"k": []byte("v1")})
+
+		wait, err := reconciler.reconcileRollout(ctx, sm, map[string][]byte{
+			"k": []byte("v1"), ".dockerconfigjson": []byte("token"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeZero())
+		Expect(sm.Status.LastRolloutTime).To(BeNil())
+		Expect(templateHash("api")).To(BeEmpty())
+	})
+})
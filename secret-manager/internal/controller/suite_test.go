@@ -33,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	mydomainv1 "github.com/huonguyenlt/secret-manager/api/v1"
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,6 +48,10 @@ var (
 	k8sClient client.Client
 )
 
+// envtestLabel labels the specs that use k8sClient, the client of the
+// envtest API server.
+const envtestLabel = "envtest"
+
 func TestControllers(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -62,8 +67,17 @@ var _ = BeforeSuite(func() {
 	err = mydomainv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = mydomainv2.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	// +kubebuilder:scaffold:scheme
 
+	// Only the specs labelled envtest need an API server. The others run
+	// without the envtest binaries with -ginkgo.label-filter='!envtest'.
+	if !Label(envtestLabel).MatchesLabelFilter(GinkgoLabelFilter()) {
+		return
+	}
+
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
@@ -86,8 +100,11 @@ var _ = BeforeSuite(func() {
 })
 
 var _ = AfterSuite(func() {
-	By("tearing down the test environment")
 	cancel()
+	if testEnv == nil {
+		return
+	}
+	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
@@ -0,0 +1,89 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// ECRClient is the part of the ECR API used by the ECR generator.
+type ECRClient interface {
+	GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput,
+		optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error)
+}
+
+type dockerConfigAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+// ECRDockerConfig requests an ECR authorization token and returns a
+// .dockerconfigjson document for the given registries, together with the time
+// the token expires. The token is valid for every registry the caller can
+// pull from, so registryIDs only select which registry hosts are listed; when
+// empty, the caller's own registry is used.
+func ECRDockerConfig(ctx context.Context, client ECRClient, region string, registryIDs []string) ([]byte, time.Time, error) {
+	out, err := client.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get ECR authorization token: %w", err)
+	}
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return nil, time.Time{}, errors.New("ECR returned no authorization data")
+	}
+	data := out.AuthorizationData[0]
+
+	decoded, err := base64.StdEncoding.DecodeString(*data.AuthorizationToken)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to decode ECR authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, time.Time{}, errors.New("malformed ECR authorization token")
+	}
+	auth := dockerConfigAuth{Username: username, Password: password, Auth: *data.AuthorizationToken}
+
+	cfg := dockerConfig{Auths: map[string]dockerConfigAuth{}}
+	for _, id := range registryIDs {
+		cfg.Auths[fmt.Sprintf("https://%s.dkr.ecr.%s.amazonaws.com", id, region)] = auth
+	}
+	if len(registryIDs) == 0 && data.ProxyEndpoint != nil {
+		cfg.Auths[*data.ProxyEndpoint] = auth
+	}
+
+	var expiresAt time.Time
+	if data.ExpiresAt != nil {
+		expiresAt = *data.ExpiresAt
+	}
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return encoded, expiresAt, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeECRClient struct {
+	out *ecr.GetAuthorizationTokenOutput
+}
+
+func (f *fakeECRClient) GetAuthorizationToken(_ context.Context, _ *ecr.GetAuthorizationTokenInput,
+	_ ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error) {
+	return f.out, nil
+}
+
+var _ = Describe("ECRDockerConfig", func() {
+	expiresAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:secret-password"))
+	client := &fakeECRClient{out: &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []ecrtypes.AuthorizationData{{
+			AuthorizationToken: aws.String(token),
+			ExpiresAt:          aws.Time(expiresAt),
+			ProxyEndpoint:      aws.String("https://111111111111.dkr.ecr.ap-southeast-1.amazonaws.com"),
+		}},
+	}}
+
+	decode := func(raw []byte) dockerConfig {
+		var cfg dockerConfig
+		Expect(json.Unmarshal(raw, &cfg)).To(Succeed())
+		return cfg
+	}
+
+	It("should use the proxy endpoint when no registries are listed", func() {
+		raw, expiry, err := ECRDockerConfig(context.Background(), client, "ap-southeast-1", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(expiry).To(Equal(expiresAt))
+		Expect(decode(raw).Auths).To(Equal(map[string]dockerConfigAuth{
+			"https://111111111111.dkr.ecr.ap-southeast-1.amazonaws.com": {
+				Username: "AWS", Password: "secret-password", Auth: token,
+			},
+		}))
+	})
+
+	It("should list every requested registry", func() {
+		raw, _, err := ECRDockerConfig(context.Background(), client, "us-east-1", []string{"222222222222", "333333333333"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decode(raw).Auths).To(HaveKey("https://222222222222.dkr.ecr.us-east-1.amazonaws.com"))
+		Expect(decode(raw).Auths).To(HaveKey("https://333333333333.dkr.ecr.us-east-1.amazonaws.com"))
+		Expect(decode(raw).Auths).To(HaveLen(2))
+	})
+})
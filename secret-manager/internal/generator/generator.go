@@ -0,0 +1,238 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package generator produces the values declared by SecretManager generators.
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+const (
+	defaultPasswordLength = 32
+	defaultRSABits        = 2048
+	defaultSSHRSABits     = 3072
+
+	lowerCharacters   = "abcdefghijklmnopqrstuvwxyz"
+	upperCharacters   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitCharacters   = "0123456789"
+	defaultSymbolsSet = "~!@#$%^&*()_+-={}[]:;<>?,./"
+)
+
+// PublicKeySuffix is appended to a generator key to name the public half of
+// a keypair.
+const PublicKeySuffix = ".pub"
+
+// Keys returns the Secret data keys written by g.
+func Keys(g mydomainv2.Generator) []string {
+	switch g.Type {
+	case mydomainv2.GeneratorTypeRSA, mydomainv2.GeneratorTypeECDSA, mydomainv2.GeneratorTypeSSH:
+		return []string{g.Key, g.Key + PublicKeySuffix}
+	default:
+		return []string{g.Key}
+	}
+}
+
+// Generate returns fresh values for g, keyed by Secret data key.
+func Generate(g mydomainv2.Generator) (map[string][]byte, error) {
+	switch g.Type {
+	case mydomainv2.GeneratorTypePassword:
+		opts := mydomainv2.PasswordGenerator{}
+		if g.Password != nil {
+			opts = *g.Password
+		}
+		password, err := Password(opts)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{g.Key: []byte(password)}, nil
+	case mydomainv2.GeneratorTypeUUID:
+		return map[string][]byte{g.Key: []byte(uuid.NewString())}, nil
+	case mydomainv2.GeneratorTypeRSA:
+		bits := defaultRSABits
+		if g.RSA != nil && g.RSA.Bits > 0 {
+			bits = g.RSA.Bits
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return encodePKCS8(g.Key, key, &key.PublicKey)
+	case mydomainv2.GeneratorTypeECDSA:
+		curve := ""
+		if g.ECDSA != nil {
+			curve = g.ECDSA.Curve
+		}
+		c, err := ellipticCurve(curve)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ecdsa.GenerateKey(c, rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ECDSA key: %w", err)
+		}
+		return encodePKCS8(g.Key, key, &key.PublicKey)
+	case mydomainv2.GeneratorTypeSSH:
+		opts := mydomainv2.SSHGenerator{}
+		if g.SSH != nil {
+			opts = *g.SSH
+		}
+		return sshKeypair(g.Key, opts)
+	case mydomainv2.GeneratorTypeECRAuthorizationToken:
+		return nil, fmt.Errorf("generator %q needs an ECR client, use ECRDockerConfig", g.Key)
+	default:
+		return nil, fmt.Errorf("unknown generator type %q", g.Type)
+	}
+}
+
+// Password returns a random password that satisfies opts.
+func Password(opts mydomainv2.PasswordGenerator) (string, error) {
+	length := opts.Length
+	if length <= 0 {
+		length = defaultPasswordLength
+	}
+	if opts.Digits < 0 || opts.Symbols < 0 || opts.Digits+opts.Symbols > length {
+		return "", fmt.Errorf("password length %d cannot hold %d digits and %d symbols",
+			length, opts.Digits, opts.Symbols)
+	}
+
+	symbols := opts.SymbolCharacters
+	if symbols == "" {
+		symbols = defaultSymbolsSet
+	}
+	letters := lowerCharacters
+	if !opts.NoUpper {
+		letters += upperCharacters
+	}
+
+	out := make([]byte, 0, length)
+	for _, req := range []struct {
+		count int
+		set   string
+	}{
+		{opts.Digits, digitCharacters},
+		{opts.Symbols, symbols},
+		{length - opts.Digits - opts.Symbols, letters + digitCharacters},
+	} {
+		for range req.count {
+			c, err := randomChar(req.set)
+			if err != nil {
+				return "", err
+			}
+			out = append(out, c)
+		}
+	}
+
+	// Shuffle so the required digits and symbols are not always at the front.
+	for i := len(out) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		out[i], out[j.Int64()] = out[j.Int64()], out[i]
+	}
+	return string(out), nil
+}
+
+func randomChar(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
+
+func ellipticCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "", "P256":
+		return elliptic.P256(), nil
+	case "P384":
+		return elliptic.P384(), nil
+	case "P521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", name)
+	}
+}
+
+func encodePKCS8(key string, private crypto.PrivateKey, public crypto.PublicKey) (map[string][]byte, error) {
+	privDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return map[string][]byte{
+		key:                   pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		key + PublicKeySuffix: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+	}, nil
+}
+
+func sshKeypair(key string, opts mydomainv2.SSHGenerator) (map[string][]byte, error) {
+	var private crypto.Signer
+	var err error
+	switch opts.KeyType {
+	case "", "ed25519":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		bits := defaultSSHRSABits
+		if opts.Bits > 0 {
+			bits = opts.Bits
+		}
+		private, err = rsa.GenerateKey(rand.Reader, bits)
+	case "ecdsa":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported SSH key type %q", opts.KeyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(private, opts.Comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SSH private key: %w", err)
+	}
+	public, err := ssh.NewPublicKey(private.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SSH public key: %w", err)
+	}
+	authorizedKey := ssh.MarshalAuthorizedKey(public)
+	if opts.Comment != "" {
+		// MarshalAuthorizedKey ends with a newline; put the comment before it.
+		authorizedKey = append(authorizedKey[:len(authorizedKey)-1], []byte(" "+opts.Comment+"\n")...)
+	}
+	return map[string][]byte{
+		key:                   pem.EncodeToMemory(block),
+		key + PublicKeySuffix: authorizedKey,
+	}, nil
+}
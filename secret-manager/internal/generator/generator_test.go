@@ -0,0 +1,119 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+var _ = Describe("Generator", func() {
+	Context("Password", func() {
+		It("should honour length and minimum character counts", func() {
+			password, err := Password(mydomainv2.PasswordGenerator{Length: 20, Digits: 5, Symbols: 4, SymbolCharacters: "!?"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(password).To(HaveLen(20))
+			Expect(strings.Count(password, "!") + strings.Count(password, "?")).To(Equal(4))
+			Expect(len(password) - len(strings.Map(func(r rune) rune {
+				if r >= '0' && r <= '9' {
+					return -1
+				}
+				return r
+			}, password))).To(BeNumerically(">=", 5))
+		})
+
+		It("should default the length", func() {
+			password, err := Password(mydomainv2.PasswordGenerator{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(password).To(HaveLen(defaultPasswordLength))
+		})
+
+		It("should exclude upper case letters when requested", func() {
+			password, err := Password(mydomainv2.PasswordGenerator{Length: 64, NoUpper: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(password).To(Equal(strings.ToLower(password)))
+		})
+
+		It("should reject rules that do not fit the length", func() {
+			_, err := Password(mydomainv2.PasswordGenerator{Length: 4, Digits: 3, Symbols: 2})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should generate a UUID", func() {
+		values, err := Generate(mydomainv2.Generator{Key: "id", Type: mydomainv2.GeneratorTypeUUID})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = uuid.ParseBytes(values["id"])
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("should generate parseable PKCS#8 keypairs",
+		func(g mydomainv2.Generator) {
+			values, err := Generate(g)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).To(HaveLen(2))
+
+			block, _ := pem.Decode(values["tls.key"])
+			Expect(block).NotTo(BeNil())
+			_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+
+			block, _ = pem.Decode(values["tls.key.pub"])
+			Expect(block).NotTo(BeNil())
+			_, err = x509.ParsePKIXPublicKey(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+		},
+		Entry("RSA", mydomainv2.Generator{Key: "tls.key", Type: mydomainv2.GeneratorTypeRSA}),
+		Entry("ECDSA P384", mydomainv2.Generator{
+			Key: "tls.key", Type: mydomainv2.GeneratorTypeECDSA, ECDSA: &mydomainv2.ECDSAGenerator{Curve: "P384"},
+		}),
+	)
+
+	DescribeTable("should generate OpenSSH keypairs",
+		func(keyType string) {
+			values, err := Generate(mydomainv2.Generator{
+				Key:  "id",
+				Type: mydomainv2.GeneratorTypeSSH,
+				SSH:  &mydomainv2.SSHGenerator{KeyType: keyType, Bits: 2048, Comment: "deploy"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			signer, err := ssh.ParsePrivateKey(values["id"])
+			Expect(err).NotTo(HaveOccurred())
+			public, comment, _, _, err := ssh.ParseAuthorizedKey(values["id.pub"])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(comment).To(Equal("deploy"))
+			Expect(public.Marshal()).To(Equal(signer.PublicKey().Marshal()))
+		},
+		Entry("ed25519", "ed25519"),
+		Entry("rsa", "rsa"),
+		Entry("ecdsa", "ecdsa"),
+	)
+
+	It("should list the keys a generator writes", func() {
+		Expect(Keys(mydomainv2.Generator{Key: "pw", Type: mydomainv2.GeneratorTypePassword})).To(Equal([]string{"pw"}))
+		Expect(Keys(mydomainv2.Generator{Key: "id", Type: mydomainv2.GeneratorTypeSSH})).To(Equal([]string{"id", "id.pub"}))
+	})
+})
@@ -0,0 +1,346 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+	"github.com/huonguyenlt/secret-manager/internal/generator"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var secretmanagerlog = logf.Log.WithName("secretmanager-resource")
+
+// defaultRefreshInterval is the refreshInterval set on SecretManagers that do
+// not choose one.
+const defaultRefreshInterval = time.Hour
+
+// SetupSecretManagerWebhookWithManager registers the webhook for SecretManager in the manager.
+func SetupSecretManagerWebhookWithManager(mgr ctrl.Manager) error {
+	// Resolve the region of the operator as the controller does when a
+	// SecretManager names no store.
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithDefaultRegion(mydomainv2.DefaultRegion))
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return ctrl.NewWebhookManagedBy(mgr).For(&mydomainv2.SecretManager{}).
+		WithValidator(&SecretManagerCustomValidator{Client: mgr.GetClient(), Region: cfg.Region}).
+		WithDefaulter(&SecretManagerCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-my-domain-v2-secretmanager,mutating=true,failurePolicy=fail,sideEffects=None,groups=my.domain,resources=secretmanagers,verbs=create;update,versions=v2,name=msecretmanager-v2.kb.io,admissionReviewVersions=v1
+
+// SecretManagerCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind SecretManager when those are created or updated.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as it is used only for temporary operations and does not need to be deeply copied.
+// +kubebuilder:object:generate=false
+type SecretManagerCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &SecretManagerCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind SecretManager.
+func (d *SecretManagerCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	secretmanager, ok := obj.(*mydomainv2.SecretManager)
+	if !ok {
+		return fmt.Errorf("expected an SecretManager object but got %T", obj)
+	}
+	secretmanagerlog.Info("Defaulting for SecretManager", "name", secretmanager.GetName())
+
+	defaultSpec(&secretmanager.Spec)
+	return nil
+}
+
+// defaultSpec fills in the refresh interval and Secret type of spec when they
+// are not set. The store is left unset so the controller reads from the
+// region of the operator.
+func defaultSpec(spec *mydomainv2.SecretManagerSpec) {
+	if spec.RefreshInterval == nil {
+		spec.RefreshInterval = &metav1.Duration{Duration: defaultRefreshInterval}
+	}
+	if spec.Target.Type == "" {
+		spec.Target.Type = corev1.SecretTypeOpaque
+		for _, g := range spec.Generators {
+			if g.Type == mydomainv2.GeneratorTypeECRAuthorizationToken {
+				spec.Target.Type = corev1.SecretTypeDockerConfigJson
+				break
+			}
+		}
+	}
+}
+
+// NOTE: The 'path' attribute must follow a specific pattern and should not be modified directly here.
+// Modifying the path for an invalid path can cause API server errors; failing to locate the webhook.
+// +kubebuilder:webhook:path=/validate-my-domain-v2-secretmanager,mutating=false,failurePolicy=fail,sideEffects=None,groups=my.domain,resources=secretmanagers,verbs=create;update,versions=v2,name=vsecretmanager-v2.kb.io,admissionReviewVersions=v1
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// SecretManagerCustomValidator struct is responsible for validating the SecretManager resource
+// when it is created or updated.
+//
+// NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
+// as this struct is used only for temporary operations and does not need to be deeply copied.
+// +kubebuilder:object:generate=false
+type SecretManagerCustomValidator struct {
+	// Client looks up the other SecretManagers and the Namespace of the
+	// validated object.
+	Client client.Reader
+	// Region is the region of the operator, used by the stores a
+	// SecretManager does not name. mydomainv2.DefaultRegion when empty.
+	Region string
+}
+
+var _ webhook.CustomValidator = &SecretManagerCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type SecretManager.
+func (v *SecretManagerCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	secretmanager, ok := obj.(*mydomainv2.SecretManager)
+	if !ok {
+		return nil, fmt.Errorf("expected a SecretManager object but got %T", obj)
+	}
+	secretmanagerlog.Info("Validation for SecretManager upon creation", "name", secretmanager.GetName())
+
+	return nil, v.validateSecretManager(ctx, secretmanager)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type SecretManager.
+func (v *SecretManagerCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	secretmanager, ok := newObj.(*mydomainv2.SecretManager)
+	if !ok {
+		return nil, fmt.Errorf("expected a SecretManager object for the newObj but got %T", newObj)
+	}
+	oldSecretmanager, ok := oldObj.(*mydomainv2.SecretManager)
+	if !ok {
+		return nil, fmt.Errorf("expected a SecretManager object for the oldObj but got %T", oldObj)
+	}
+	secretmanagerlog.Info("Validation for SecretManager upon update", "name", secretmanager.GetName())
+
+	if secretmanager.Spec.Target.Name != oldSecretmanager.Spec.Target.Name {
+		return nil, apierrors.NewInvalid(mydomainv2.GroupVersion.WithKind("SecretManager").GroupKind(),
+			secretmanager.Name, field.ErrorList{
+				field.Invalid(field.NewPath("spec", "target", "name"), secretmanager.Spec.Target.Name, "field is immutable"),
+			})
+	}
+	return nil, v.validateSecretManager(ctx, secretmanager)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type SecretManager.
+func (v *SecretManagerCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateSecretManager returns an Invalid error listing every problem with
+// secretmanager, or nil when there are none.
+func (v *SecretManagerCustomValidator) validateSecretManager(ctx context.Context, secretmanager *mydomainv2.SecretManager) error {
+	allErrs := validateSpec(&secretmanager.Spec, field.NewPath("spec"))
+
+	if secretmanager.Spec.Target.Name != "" {
+		dup, err := v.targetInUse(ctx, secretmanager)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		if dup != "" {
+			allErrs = append(allErrs, field.Duplicate(field.NewPath("spec", "target", "name"),
+				fmt.Sprintf("%s (already managed by SecretManager %s)", secretmanager.Spec.Target.Name, dup)))
+		}
+	}
+
+	storeErrs, err := v.validateStores(ctx, secretmanager)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	allErrs = append(allErrs, storeErrs...)
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(mydomainv2.GroupVersion.WithKind("SecretManager").GroupKind(),
+		secretmanager.Name, allErrs)
+}
+
+// validateSpec checks the fields of spec that can be validated on their own.
+func validateSpec(spec *mydomainv2.SecretManagerSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.Target.Name == "" {
+		allErrs = append(allErrs, field.Required(path.Child("target", "name"), "the target Secret needs a name"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.Target.Name) {
+			allErrs = append(allErrs, field.Invalid(path.Child("target", "name"), spec.Target.Name, msg))
+		}
+	}
+
+	if len(spec.Sources) == 0 && len(spec.Generators) == 0 {
+		allErrs = append(allErrs, field.Required(path.Child("sources"),
+			"a source secret is required unless the Secret only holds generated values"))
+	}
+	if spec.PushGenerated && len(spec.Sources) == 0 {
+		allErrs = append(allErrs, field.Required(path.Child("sources"),
+			"pushGenerated needs a source secret to push to"))
+	}
+	for i, source := range spec.Sources {
+		if source.SecretName == "" {
+			allErrs = append(allErrs, field.Required(path.Child("sources").Index(i).Child("secretName"), ""))
+		}
+	}
+
+	keys := map[string]bool{}
+	for i, g := range spec.Generators {
+		keyPath := path.Child("generators").Index(i).Child("key")
+		for _, msg := range validation.IsConfigMapKey(g.Key) {
+			allErrs = append(allErrs, field.Invalid(keyPath, g.Key, msg))
+		}
+		// Keypairs also write their public key next to the private one
+		for _, key := range generator.Keys(g) {
+			if keys[key] {
+				allErrs = append(allErrs, field.Duplicate(keyPath, key))
+			}
+			keys[key] = true
+		}
+		if g.Type == mydomainv2.GeneratorTypeECRAuthorizationToken && g.Key != corev1.DockerConfigJsonKey {
+			allErrs = append(allErrs, field.Invalid(keyPath, g.Key,
+				fmt.Sprintf("ECR authorization tokens must be written to %s", corev1.DockerConfigJsonKey)))
+		}
+	}
+
+	if d := spec.RefreshInterval; d != nil && d.Duration < time.Second {
+		allErrs = append(allErrs, field.Invalid(path.Child("refreshInterval"), d.Duration.String(),
+			"must be at least 1s"))
+	}
+	if d := spec.RolloutMinInterval; d != nil && d.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("rolloutMinInterval"), d.Duration.String(),
+			"must not be negative"))
+	}
+	for i, t := range spec.RolloutTargets {
+		targetPath := path.Child("rolloutTargets").Index(i)
+		if (t.Name == "") == (t.Selector == nil) {
+			allErrs = append(allErrs, field.Invalid(targetPath, t.Name, "exactly one of name and selector must be set"))
+		}
+	}
+
+	return allErrs
+}
+
+// targetInUse returns the name of another SecretManager in the namespace that
+// already manages the target Secret of secretmanager, if any.
+func (v *SecretManagerCustomValidator) targetInUse(ctx context.Context, secretmanager *mydomainv2.SecretManager) (string, error) {
+	var list mydomainv2.SecretManagerList
+	if err := v.Client.List(ctx, &list, client.InNamespace(secretmanager.Namespace)); err != nil {
+		return "", fmt.Errorf("failed to list SecretManagers: %w", err)
+	}
+	for _, other := range list.Items {
+		if other.Name != secretmanager.Name && other.Spec.Target.Name == secretmanager.Spec.Target.Name {
+			return other.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// validateStores rejects references to AWS regions the Namespace of
+// secretmanager is not allowed to use.
+func (v *SecretManagerCustomValidator) validateStores(ctx context.Context, secretmanager *mydomainv2.SecretManager) (field.ErrorList, error) {
+	var ns corev1.Namespace
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: secretmanager.Namespace}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get namespace %s: %w", secretmanager.Namespace, err)
+	}
+	value, ok := ns.Annotations[mydomainv2.AllowedStoresAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var allowed []string
+	for _, region := range strings.Split(value, ",") {
+		allowed = append(allowed, strings.TrimSpace(region))
+	}
+
+	var allErrs field.ErrorList
+	region := v.Region
+	if region == "" {
+		region = mydomainv2.DefaultRegion
+	}
+	for _, ref := range storeReferences(&secretmanager.Spec, region, field.NewPath("spec")) {
+		if !slices.Contains(allowed, ref.region) {
+			allErrs = append(allErrs, field.Forbidden(ref.path,
+				fmt.Sprintf("namespace %s may not use store %s", secretmanager.Namespace, ref.region)))
+		}
+	}
+	return allErrs, nil
+}
+
+// storeReference is a field of a SecretManager that reads from or writes to
+// the AWS store in region.
+type storeReference struct {
+	path   *field.Path
+	region string
+}
+
+// storeReferences returns the store references in spec, in defaultRegion
+// when spec names no store.
+func storeReferences(spec *mydomainv2.SecretManagerSpec, defaultRegion string, path *field.Path) []storeReference {
+	if spec.StoreRef != nil {
+		defaultRegion = spec.StoreRef.Region
+	}
+
+	var refs []storeReference
+	for i, source := range spec.Sources {
+		sourcePath := path.Child("sources").Index(i)
+		if source.StoreRef != nil {
+			refs = append(refs, storeReference{sourcePath.Child("storeRef", "region"), source.StoreRef.Region})
+			continue
+		}
+		region := defaultRegion
+		if parsed, err := arn.Parse(source.SecretName); err == nil {
+			region = parsed.Region
+		}
+		refs = append(refs, storeReference{sourcePath.Child("secretName"), region})
+	}
+	for i, g := range spec.Generators {
+		if g.Type != mydomainv2.GeneratorTypeECRAuthorizationToken {
+			continue
+		}
+		region := defaultRegion
+		if g.ECR != nil && g.ECR.Region != "" {
+			region = g.ECR.Region
+		}
+		refs = append(refs, storeReference{path.Child("generators").Index(i).Child("ecr", "region"), region})
+	}
+	return refs
+}
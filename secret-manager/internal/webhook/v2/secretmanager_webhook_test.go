@@ -0,0 +1,242 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mydomainv2 "github.com/huonguyenlt/secret-manager/api/v2"
+)
+
+var _ = Describe("SecretManager Webhook", func() {
+	var (
+		ctx       context.Context
+		obj       *mydomainv2.SecretManager
+		validator SecretManagerCustomValidator
+		existing  []client.Object
+		region    string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		obj = &mydomainv2.SecretManager{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a"},
+			Spec: mydomainv2.SecretManagerSpec{
+				Target:  mydomainv2.SecretTarget{Name: "app-secret"},
+				Sources: []mydomainv2.SecretSource{{SecretName: "team-a/prod/app"}},
+			},
+		}
+		existing = []client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		}
+		region = ""
+	})
+
+	validate := func() error {
+		validator = SecretManagerCustomValidator{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing...).Build(),
+			Region: region,
+		}
+		_, err := validator.ValidateCreate(ctx, obj)
+		return err
+	}
+
+	Context("When creating or updating SecretManager under Validating Webhook", func() {
+		It("Should admit a valid SecretManager", func() {
+			Expect(validate()).To(Succeed())
+		})
+
+		It("Should deny creation if the target name is empty", func() {
+			obj.Spec.Target.Name = ""
+			Expect(validate()).To(MatchError(ContainSubstring("spec.target.name: Required value")))
+		})
+
+		It("Should deny creation if the target name is not a valid Secret name", func() {
+			obj.Spec.Target.Name = "App_Secret"
+			Expect(validate()).To(MatchError(ContainSubstring("spec.target.name: Invalid value")))
+		})
+
+		It("Should deny creation if the source secret is empty without generators", func() {
+			obj.Spec.Sources = nil
+			Expect(validate()).To(MatchError(ContainSubstring("spec.sources: Required value")))
+		})
+
+		It("Should admit an empty source secret when the Secret only holds generated values", func() {
+			obj.Spec.Sources = nil
+			obj.Spec.Generators = []mydomainv2.Generator{{Key: "password", Type: mydomainv2.GeneratorTypePassword}}
+			Expect(validate()).To(Succeed())
+		})
+
+		It("Should deny creation if the target Secret is managed by another SecretManager", func() {
+			existing = append(existing, &mydomainv2.SecretManager{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team-a"},
+				Spec: mydomainv2.SecretManagerSpec{
+					Target:  mydomainv2.SecretTarget{Name: "app-secret"},
+					Sources: []mydomainv2.SecretSource{{SecretName: "other"}},
+				},
+			})
+			Expect(validate()).To(MatchError(ContainSubstring("already managed by SecretManager other")))
+		})
+
+		It("Should admit the same target name in another namespace", func() {
+			existing = append(existing, &mydomainv2.SecretManager{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team-b"},
+				Spec: mydomainv2.SecretManagerSpec{
+					Target:  mydomainv2.SecretTarget{Name: "app-secret"},
+					Sources: []mydomainv2.SecretSource{{SecretName: "other"}},
+				},
+			})
+			Expect(validate()).To(Succeed())
+		})
+
+		It("Should deny a negative rollout interval", func() {
+			obj.Spec.RolloutMinInterval = &metav1.Duration{Duration: -time.Minute}
+			Expect(validate()).To(MatchError(ContainSubstring("spec.rolloutMinInterval")))
+		})
+
+		It("Should deny a refresh interval below one second", func() {
+			obj.Spec.RefreshInterval = &metav1.Duration{Duration: 500 * time.Millisecond}
+			Expect(validate()).To(MatchError(ContainSubstring("spec.refreshInterval")))
+		})
+
+		It("Should deny changing the target name", func() {
+			validator = SecretManagerCustomValidator{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing...).Build(),
+			}
+			oldObj := obj.DeepCopy()
+			obj.Spec.Target.Name = "other-secret"
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.target.name: Invalid value")))
+		})
+
+		It("Should deny rollout targets with both a name and a selector", func() {
+			obj.Spec.RolloutTargets = []mydomainv2.RolloutTarget{{
+				Kind:     mydomainv2.RolloutTargetKindDeployment,
+				Name:     "api",
+				Selector: &metav1.LabelSelector{},
+			}}
+			Expect(validate()).To(MatchError(ContainSubstring("spec.rolloutTargets[0]")))
+		})
+
+		It("Should deny duplicate generator keys", func() {
+			obj.Spec.Generators = []mydomainv2.Generator{
+				{Key: "password", Type: mydomainv2.GeneratorTypePassword},
+				{Key: "password", Type: mydomainv2.GeneratorTypeUUID},
+			}
+			Expect(validate()).To(MatchError(ContainSubstring("spec.generators[1].key: Duplicate value")))
+		})
+
+		It("Should deny a generator key taken by the public key of a keypair", func() {
+			obj.Spec.Generators = []mydomainv2.Generator{
+				{Key: "id_rsa", Type: mydomainv2.GeneratorTypeRSA},
+				{Key: "id_rsa.pub", Type: mydomainv2.GeneratorTypePassword},
+			}
+			Expect(validate()).To(MatchError(ContainSubstring(`spec.generators[1].key: Duplicate value: "id_rsa.pub"`)))
+		})
+
+		It("Should deny a keypair whose public key is taken by another generator", func() {
+			obj.Spec.Generators = []mydomainv2.Generator{
+				{Key: "id_ecdsa.pub", Type: mydomainv2.GeneratorTypeUUID},
+				{Key: "id_ecdsa", Type: mydomainv2.GeneratorTypeECDSA},
+			}
+			Expect(validate()).To(MatchError(ContainSubstring(`spec.generators[1].key: Duplicate value: "id_ecdsa.pub"`)))
+		})
+
+		Context("with a namespace restricted to some stores", func() {
+			BeforeEach(func() {
+				existing = []client.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:        "team-a",
+					Annotations: map[string]string{mydomainv2.AllowedStoresAnnotation: "ap-southeast-1, eu-west-1"},
+				}}}
+			})
+
+			It("Should admit the default store when it is allowed", func() {
+				Expect(validate()).To(Succeed())
+			})
+
+			It("Should deny a source secret in another region", func() {
+				obj.Spec.Sources[0].SecretName = "arn:aws:secretsmanager:us-east-1:111111111111:secret:app-AbCdEf"
+				Expect(validate()).To(MatchError(ContainSubstring("may not use store us-east-1")))
+			})
+
+			It("Should deny a source secret when the region of the operator is not allowed", func() {
+				region = "us-east-1"
+				Expect(validate()).To(MatchError(ContainSubstring("spec.sources[0].secretName: Forbidden")))
+			})
+
+			It("Should deny a source secret when the SecretManager region is not allowed", func() {
+				obj.Spec.StoreRef = &mydomainv2.StoreRef{Region: "us-east-1"}
+				Expect(validate()).To(MatchError(ContainSubstring("spec.sources[0].secretName: Forbidden")))
+			})
+
+			It("Should deny a source overriding the store with another region", func() {
+				obj.Spec.Sources = append(obj.Spec.Sources, mydomainv2.SecretSource{
+					SecretName: "team-a/prod/shared",
+					StoreRef:   &mydomainv2.StoreRef{Region: "us-east-1"},
+				})
+				Expect(validate()).To(MatchError(ContainSubstring("spec.sources[1].storeRef.region: Forbidden")))
+			})
+
+			It("Should deny an ECR generator in another region", func() {
+				obj.Spec.Generators = []mydomainv2.Generator{{
+					Key:  corev1.DockerConfigJsonKey,
+					Type: mydomainv2.GeneratorTypeECRAuthorizationToken,
+					ECR:  &mydomainv2.ECRGenerator{Region: "us-west-2"},
+				}}
+				Expect(validate()).To(MatchError(ContainSubstring("spec.generators[0].ecr.region: Forbidden")))
+			})
+		})
+	})
+
+	Context("When creating or updating SecretManager under Defaulting Webhook", func() {
+		var defaulter SecretManagerCustomDefaulter
+
+		It("Should fill in the refresh interval and Secret type", func() {
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.StoreRef).To(BeNil())
+			Expect(obj.Spec.RefreshInterval).To(Equal(&metav1.Duration{Duration: time.Hour}))
+			Expect(obj.Spec.Target.Type).To(Equal(corev1.SecretTypeOpaque))
+		})
+
+		It("Should default the Secret type to a docker config for ECR generators", func() {
+			obj.Spec.Generators = []mydomainv2.Generator{{
+				Key:  corev1.DockerConfigJsonKey,
+				Type: mydomainv2.GeneratorTypeECRAuthorizationToken,
+			}}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Target.Type).To(Equal(corev1.SecretTypeDockerConfigJson))
+		})
+
+		It("Should keep values that are already set", func() {
+			obj.Spec.StoreRef = &mydomainv2.StoreRef{Region: "eu-west-1"}
+			obj.Spec.RefreshInterval = &metav1.Duration{Duration: time.Minute}
+			obj.Spec.Target.Type = corev1.SecretTypeBasicAuth
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.StoreRef.Region).To(Equal("eu-west-1"))
+			Expect(obj.Spec.RefreshInterval.Duration).To(Equal(time.Minute))
+			Expect(obj.Spec.Target.Type).To(Equal(corev1.SecretTypeBasicAuth))
+		})
+	})
+})
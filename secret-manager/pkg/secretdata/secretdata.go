@@ -0,0 +1,158 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secretdata converts AWS Secrets Manager values to Kubernetes Secret
+// data. The operator and the sync Lambda both use it, so a secret comes out
+// byte-identical whichever of them writes it.
+package secretdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DefaultKey holds binary secrets and string secrets that are not JSON
+// objects.
+const DefaultKey = "secret"
+
+// Options control how JSON object secrets are split into keys.
+type Options struct {
+	// Separator flattens nested objects into one key per leaf, joining the
+	// field names with it, so {"db":{"host":"h"}} becomes "db.host" for ".".
+	// When empty, nested objects are stored as JSON. Arrays are always stored
+	// as JSON.
+	Separator string
+}
+
+// Decode converts the value of an AWS secret to Secret data. JSON objects are
+// split into one key per field: strings are stored as is, numbers as written
+// in the secret, booleans as "true" or "false", null as the empty string and
+// nested values according to opts. Anything else is stored under DefaultKey.
+func Decode(secretString *string, secretBinary []byte, opts Options) (map[string][]byte, error) {
+	if secretString == nil {
+		if secretBinary == nil {
+			return map[string][]byte{}, nil
+		}
+		return map[string][]byte{DefaultKey: secretBinary}, nil
+	}
+
+	fields, ok := decodeObject(*secretString)
+	if !ok {
+		return map[string][]byte{DefaultKey: []byte(*secretString)}, nil
+	}
+	data := make(map[string][]byte, len(fields))
+	if err := flatten(data, "", fields, opts); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decodeObject decodes s when it holds exactly one JSON object, keeping
+// numbers as written.
+func decodeObject(s string) (map[string]any, bool) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(s)))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil || fields == nil {
+		return nil, false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+	return fields, true
+}
+
+// flatten adds the fields of an object to data, prefixing their keys.
+func flatten(data map[string][]byte, prefix string, fields map[string]any, opts Options) error {
+	for name, value := range fields {
+		key := prefix + name
+		if nested, ok := value.(map[string]any); ok && opts.Separator != "" {
+			if err := flatten(data, key+opts.Separator, nested, opts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, ok := data[key]; ok {
+			return fmt.Errorf("key %q appears more than once after flattening", key)
+		}
+		encoded, err := encodeValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode key %q: %w", key, err)
+		}
+		data[key] = encoded
+	}
+	return nil
+}
+
+// encodeValue returns the Secret data of a single JSON value.
+func encodeValue(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(v), nil
+	case json.Number:
+		return []byte(v), nil
+	case bool:
+		return fmt.Appendf(nil, "%t", v), nil
+	}
+
+	// Objects and arrays are stored as compact JSON
+	return marshal(value)
+}
+
+// Merge returns secretString with values set as string fields. The other
+// fields of the JSON object keep their value as written, nested objects,
+// numbers and booleans included. A nil secretString is an empty object.
+func Merge(secretString *string, values map[string][]byte) (string, error) {
+	fields := map[string]json.RawMessage{}
+	if secretString != nil {
+		if _, ok := decodeObject(*secretString); !ok {
+			return "", fmt.Errorf("secret is not a JSON object")
+		}
+		if err := json.Unmarshal([]byte(*secretString), &fields); err != nil {
+			return "", err
+		}
+	}
+
+	for key, value := range values {
+		encoded, err := marshal(string(value))
+		if err != nil {
+			return "", fmt.Errorf("failed to encode key %q: %w", key, err)
+		}
+		fields[key] = encoded
+	}
+	merged, err := marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+// marshal returns the compact JSON of value, without escaping HTML
+// characters the way json.Marshal does.
+func marshal(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretdata
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Decode", func() {
+	data := func(pairs ...string) map[string][]byte {
+		result := map[string][]byte{}
+		for i := 0; i < len(pairs); i += 2 {
+			result[pairs[i]] = []byte(pairs[i+1])
+		}
+		return result
+	}
+
+	DescribeTable("JSON object secrets",
+		func(secret, separator string, expected map[string][]byte) {
+			Expect(Decode(ptr.To(secret), nil, Options{Separator: separator})).To(Equal(expected))
+		},
+		Entry("strings", `{"username":"admin","password":"p@ss"}`, "", data("username", "admin", "password", "p@ss")),
+		Entry("numbers as written", `{"port":5432,"limit":1000000,"ratio":0.25,"big":12345678901234567890,"exp":1e6}`, "",
+			data("port", "5432", "limit", "1000000", "ratio", "0.25", "big", "12345678901234567890", "exp", "1e6")),
+		Entry("booleans and null", `{"tls":true,"debug":false,"token":null}`, "", data("tls", "true", "debug", "false", "token", "")),
+		Entry("nested values as JSON", `{"db":{"host":"<db>","port":5432},"hosts":["a","b"]}`, "",
+			data("db", `{"host":"<db>","port":5432}`, "hosts", `["a","b"]`)),
+		Entry("flattened nested objects", `{"db":{"host":"h","opts":{"tls":true}},"hosts":["a","b"]}`, ".",
+			data("db.host", "h", "db.opts.tls", "true", "hosts", `["a","b"]`)),
+		Entry("empty objects", `{}`, "", data()),
+	)
+
+	DescribeTable("other secrets",
+		func(secret string) {
+			Expect(Decode(ptr.To(secret), nil, Options{})).To(Equal(data(DefaultKey, secret)))
+		},
+		Entry("plain text", "hunter2"),
+		Entry("JSON arrays", `["a","b"]`),
+		Entry("JSON strings", `"hunter2"`),
+		Entry("JSON null", `null`),
+		Entry("several JSON objects", `{"a":"1"}{"b":"2"}`),
+		Entry("empty strings", ""),
+	)
+
+	It("Should store binary secrets under the default key", func() {
+		Expect(Decode(nil, []byte{0, 1, 2}, Options{})).To(Equal(map[string][]byte{DefaultKey: {0, 1, 2}}))
+		Expect(Decode(nil, nil, Options{})).To(BeEmpty())
+	})
+
+	It("Should reject keys that collide after flattening", func() {
+		_, err := Decode(ptr.To(`{"db.host":"a","db":{"host":"b"}}`), nil, Options{Separator: "."})
+		Expect(err).To(MatchError(ContainSubstring(`"db.host"`)))
+	})
+})
+
+var _ = Describe("Merge", func() {
+	It("Should keep the other fields as written", func() {
+		merged, err := Merge(ptr.To(`{"db": {"host": "<db>", "port": 5432}, "big": 12345678901234567890, "tls": true, "password": "old"}`),
+			map[string][]byte{"password": []byte("new"), "id_rsa": []byte("-----BEGIN\n")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged).To(Equal(`{"big":12345678901234567890,"db":{"host":"<db>","port":5432},"id_rsa":"-----BEGIN\n","password":"new","tls":true}`))
+	})
+
+	It("Should create an object for a new secret", func() {
+		Expect(Merge(nil, map[string][]byte{"password": []byte("p")})).To(Equal(`{"password":"p"}`))
+	})
+
+	It("Should reject secrets that are not JSON objects", func() {
+		_, err := Merge(ptr.To("hunter2"), map[string][]byte{"password": []byte("p")})
+		Expect(err).To(MatchError(ContainSubstring("not a JSON object")))
+	})
+})